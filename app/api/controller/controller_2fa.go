@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// recoveryCodeCount is the number of one-time recovery codes issued when 2FA is enabled.
+const recoveryCodeCount = 10
+
+// mfaChallengeType marks challenge tokens so they cannot be used as access tokens.
+const mfaChallengeType = "mfa_challenge"
+
+// ErrInvalidTOTPCode is returned when a two-factor code or recovery code is wrong or was already used.
+var ErrInvalidTOTPCode = errors.New("invalid two-factor authentication code")
+
+// ErrInvalidChallenge is returned when a two-factor login challenge is invalid or has expired.
+var ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+
+// ErrTOTPAlreadyEnabled is returned when enrolling a user who already has 2FA enabled.
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// ErrTOTPNotEnrolled is returned when confirming or disabling 2FA that was never set up.
+var ErrTOTPNotEnrolled = errors.New("two-factor authentication is not set up")
+
+// TOTPEnrollmentResponse represents the secret to add to an authenticator app.
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResponse represents the recovery codes issued when 2FA is enabled.
+// The codes are shown only once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. Two-factor authentication
+// is enabled only after ConfirmTOTP succeeds with a code from the secret.
+func EnrollTOTP(username string) (TOTPEnrollmentResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return TOTPEnrollmentResponse{}, err
+	}
+	if user.TOTPEnabled {
+		return TOTPEnrollmentResponse{}, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return TOTPEnrollmentResponse{}, err
+	}
+	if err := db.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		if errors.Is(err, db.ErrTOTPAlreadyEnabled) {
+			return TOTPEnrollmentResponse{}, ErrTOTPAlreadyEnabled
+		}
+		return TOTPEnrollmentResponse{}, err
+	}
+
+	return TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, config.C.TOTPIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves they can
+// generate codes, and returns a fresh set of recovery codes.
+func ConfirmTOTP(username, code string) (RecoveryCodesResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return RecoveryCodesResponse{}, err
+	}
+	state, err := db.GetTOTPState(user.ID)
+	if err != nil {
+		return RecoveryCodesResponse{}, err
+	}
+	if state.Enabled {
+		return RecoveryCodesResponse{}, ErrTOTPAlreadyEnabled
+	}
+	if state.Secret == "" {
+		return RecoveryCodesResponse{}, ErrTOTPNotEnrolled
+	}
+
+	step, ok := auth.ValidateTOTP(state.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return RecoveryCodesResponse{}, ErrInvalidTOTPCode
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return RecoveryCodesResponse{}, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, auth.HashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := db.EnableTOTP(user.ID, step, hashes); err != nil {
+		if errors.Is(err, db.ErrTOTPAlreadyEnabled) {
+			return RecoveryCodesResponse{}, ErrTOTPAlreadyEnabled
+		}
+		return RecoveryCodesResponse{}, err
+	}
+	return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP turns off two-factor authentication after checking a current code or recovery code.
+func DisableTOTP(username, code string) error {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+	if err := verifySecondFactor(user, code); err != nil {
+		return err
+	}
+	return db.DisableTOTP(user.ID)
+}
+
+// CompleteTwoFactorLogin exchanges a login challenge and a TOTP or recovery code for session tokens.
+// Wrong codes count as failed login attempts. Each challenge can be exchanged only once.
+func CompleteTwoFactorLogin(challengeToken, code string, client ClientInfo) (TokenResponse, error) {
+	challenge, err := parseMFAChallenge(challengeToken)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	user := challenge.User
+
+	// Refuse a used challenge before the code is checked, so that replaying it
+	// does not use up a recovery code.
+	if used, err := db.MFAChallengeUsed(challenge.ID); err != nil {
+		return TokenResponse{}, err
+	} else if used {
+		return TokenResponse{}, ErrInvalidChallenge
+	}
+
+	keys := loginThrottleKeys(user.Email, client.IPAddress)
+	if err := checkLoginLockout(keys); err != nil {
+		return TokenResponse{}, err
+	}
+	if err := verifySecondFactor(user, code); err != nil {
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			recordLoginFailure(keys)
+		}
+		return TokenResponse{}, err
+	}
+	fresh, err := db.UseMFAChallenge(challenge.ID, challenge.ExpiresAt)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if !fresh {
+		return TokenResponse{}, ErrInvalidChallenge
+	}
+
+	tokens, err := issueTokens(user, uuid.New().String(), client)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	clearLoginFailures(user.Email)
+	return tokens, nil
+}
+
+// issueMFAChallenge returns a short-lived token proving the user passed the password check.
+func issueMFAChallenge(user *db.User) (string, error) {
+	now := time.Now()
+	return auth.Keys.Sign(jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"sub": user.ID,
+		"typ": mfaChallengeType,
+		"iat": now.Unix(),
+		"exp": now.Add(config.C.MFAChallengeTTL).Unix(),
+	})
+}
+
+// mfaChallenge is a validated two-factor login challenge.
+type mfaChallenge struct {
+	// ID is the token's jti, recorded when the challenge is used.
+	ID        string
+	User      *db.User
+	ExpiresAt time.Time
+}
+
+// parseMFAChallenge validates a challenge token and returns it with the user it was issued to.
+func parseMFAChallenge(challengeToken string) (*mfaChallenge, error) {
+	claims := jwt.MapClaims{}
+	token, err := auth.Keys.Parse(challengeToken, claims)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidChallenge
+	}
+	if typ, _ := claims["typ"].(string); typ != mfaChallengeType {
+		return nil, ErrInvalidChallenge
+	}
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" || exp == 0 {
+		return nil, ErrInvalidChallenge
+	}
+	userID, _ := claims["sub"].(string)
+	user, err := db.GetUserByID(userID)
+	if err != nil || !user.TOTPEnabled {
+		return nil, ErrInvalidChallenge
+	}
+	return &mfaChallenge{ID: jti, User: user, ExpiresAt: time.Unix(int64(exp), 0)}, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+// Each TOTP code and each recovery code can be used only once.
+func verifySecondFactor(user *db.User, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidTOTPCode
+	}
+
+	state, err := db.GetTOTPState(user.ID)
+	if err != nil {
+		return err
+	}
+	if step, ok := auth.ValidateTOTP(state.Secret, code, time.Now()); ok {
+		fresh, err := db.RecordTOTPStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTOTPCode
+		}
+		return nil
+	}
+
+	used, err := db.UseRecoveryCode(user.ID, auth.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// generateRecoveryCode returns a random code formatted as two groups of five characters.
+func generateRecoveryCode() (string, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(secret[:10])
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be typed loosely.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/1akhilpandey/go-messaging/db/dbtest"
+)
+
+// setupTwoFactor creates a user with two-factor authentication enabled and
+// returns them with their TOTP secret and recovery codes.
+func setupTwoFactor(t *testing.T) (*db.User, string, []string) {
+	t.Helper()
+	dbtest.Setup(t)
+	if _, err := auth.InitKeys("", "test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	user := insertUser(t, "dana")
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{"aaaaa-11111", "bbbbb-22222", "ccccc-33333"}
+	var hashes []string
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashToken(normalizeRecoveryCode(code)))
+	}
+	if err := db.EnableTOTP(user.ID, 0, hashes); err != nil {
+		t.Fatal(err)
+	}
+	return user, secret, codes
+}
+
+// loginChallenge logs the user in with their password and returns the two-factor challenge.
+func loginChallenge(t *testing.T, user *db.User) string {
+	t.Helper()
+	resp, err := LoginUser(user.Email, "password", ClientInfo{DeviceName: "test"})
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	if !resp.MFARequired || resp.ChallengeToken == "" {
+		t.Fatalf("response = %+v, want a two-factor challenge", resp)
+	}
+	return resp.ChallengeToken
+}
+
+func TestTwoFactorChallengeIsSingleUse(t *testing.T) {
+	user, _, codes := setupTwoFactor(t)
+	challenge := loginChallenge(t, user)
+
+	if _, err := CompleteTwoFactorLogin(challenge, codes[0], ClientInfo{}); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := CompleteTwoFactorLogin(challenge, codes[1], ClientInfo{}); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("second use = %v, want ErrInvalidChallenge", err)
+	}
+
+	// A new login gets a new challenge.
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), codes[1], ClientInfo{}); err != nil {
+		t.Fatalf("new challenge: %v", err)
+	}
+}
+
+func TestTwoFactorChallengeForgedWithOtherKey(t *testing.T) {
+	user, _, codes := setupTwoFactor(t)
+	if _, err := auth.InitKeys("", "attacker-secret"); err != nil {
+		t.Fatal(err)
+	}
+	forged, err := issueMFAChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.InitKeys("", "test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompleteTwoFactorLogin(forged, codes[0], ClientInfo{}); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("forged challenge = %v, want ErrInvalidChallenge", err)
+	}
+}
+
+// totpAt computes the 6-digit code of the secret at the given time, as an authenticator app does.
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	dbtest.Setup(t)
+	if _, err := auth.InitKeys("", "test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	user := insertUser(t, "gina")
+	enrollment, err := EnrollTOTP(user.Username)
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+
+	code := totpAt(t, enrollment.Secret, time.Now())
+	wrong := "000000"
+	if wrong == code {
+		wrong = "000001"
+	}
+	if _, err := ConfirmTOTP(user.Username, wrong); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("ConfirmTOTP with a wrong code = %v, want ErrInvalidTOTPCode", err)
+	}
+	resp, err := ConfirmTOTP(user.Username, code)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	if len(resp.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(resp.RecoveryCodes), recoveryCodeCount)
+	}
+	if _, err := ConfirmTOTP(user.Username, code); !errors.Is(err, ErrTOTPAlreadyEnabled) {
+		t.Errorf("second ConfirmTOTP = %v, want ErrTOTPAlreadyEnabled", err)
+	}
+	if _, err := EnrollTOTP(user.Username); !errors.Is(err, ErrTOTPAlreadyEnabled) {
+		t.Errorf("EnrollTOTP after enabling = %v, want ErrTOTPAlreadyEnabled", err)
+	}
+
+	// The code used to confirm cannot also complete a login.
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), code, ClientInfo{}); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("login with the confirmation code = %v, want ErrInvalidTOTPCode", err)
+	}
+}
+
+func TestTwoFactorLoginRejectsReplayedCode(t *testing.T) {
+	user, secret, _ := setupTwoFactor(t)
+	code := totpAt(t, secret, time.Now())
+
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), code, ClientInfo{}); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), code, ClientInfo{}); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("login with the same code = %v, want ErrInvalidTOTPCode", err)
+	}
+	// Neither can the code of an earlier period, once a later one was used.
+	earlier := totpAt(t, secret, time.Now().Add(-30*time.Second))
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), earlier, ClientInfo{}); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("login with an earlier code = %v, want ErrInvalidTOTPCode", err)
+	}
+	if err := DisableTOTP(user.Username, code); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("DisableTOTP with a used code = %v, want ErrInvalidTOTPCode", err)
+	}
+}
+
+func TestTwoFactorLoginRecoveryCodes(t *testing.T) {
+	user, _, codes := setupTwoFactor(t)
+
+	// Recovery codes may be typed in upper case and without the dash.
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), "AAAAA 11111", ClientInfo{}); err != nil {
+		t.Fatalf("login with a recovery code: %v", err)
+	}
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), codes[0], ClientInfo{}); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("login with a used recovery code = %v, want ErrInvalidTOTPCode", err)
+	}
+	if _, err := CompleteTwoFactorLogin(loginChallenge(t, user), codes[1], ClientInfo{}); err != nil {
+		t.Errorf("login with another recovery code: %v", err)
+	}
+	if err := DisableTOTP(user.Username, codes[2]); err != nil {
+		t.Fatalf("DisableTOTP with a recovery code: %v", err)
+	}
+	if resp, err := LoginUser(user.Email, "password", ClientInfo{}); err != nil || resp.MFARequired {
+		t.Errorf("login after disabling = %+v, %v; want tokens", resp, err)
+	}
+}
@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/google/uuid"
+)
+
+// apiKeyDisplayLength is how many leading characters of a key are kept to help users recognise it.
+const apiKeyDisplayLength = 11
+
+// ErrInvalidScope is returned when an API key is requested with an unknown scope or without scopes.
+var ErrInvalidScope = errors.New("invalid API key scopes")
+
+// ErrAdminScopeNotAllowed is returned when a non-administrator requests the admin scope.
+var ErrAdminScopeNotAllowed = errors.New("only administrators can create keys with the admin scope")
+
+// ErrInvalidExpiry is returned when an API key's expiry is in the past.
+var ErrInvalidExpiry = errors.New("expires_at must be in the future")
+
+// ErrServiceAccountNotFound is returned when a user ID does not belong to a service account.
+var ErrServiceAccountNotFound = errors.New("service account not found")
+
+// CreateAPIKeyInput defines the data required to create an API key.
+type CreateAPIKeyInput struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// APIKeyResponse describes an API key without its secret value.
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKeyResponse includes the secret key value, which is shown only once.
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// GetAPIKeysResponse represents the data returned when listing API keys.
+type GetAPIKeysResponse struct {
+	APIKeys []APIKeyResponse `json:"api_keys"`
+	Count   int              `json:"count"`
+}
+
+// ServiceAccountResponse describes a service account.
+type ServiceAccountResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// CreateAPIKey creates an API key for the user.
+func CreateAPIKey(username string, input CreateAPIKeyInput) (CreatedAPIKeyResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	return createAPIKey(user, input)
+}
+
+// GetAPIKeys lists the user's API keys.
+func GetAPIKeys(username string) (GetAPIKeysResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return GetAPIKeysResponse{}, err
+	}
+	return getAPIKeys(user)
+}
+
+// RotateAPIKey issues a new secret for one of the user's API keys, keeping its name and scopes.
+func RotateAPIKey(username, keyID string) (CreatedAPIKeyResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	return rotateAPIKey(user, keyID)
+}
+
+// RevokeAPIKey revokes one of the user's API keys.
+func RevokeAPIKey(username, keyID string) error {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	return revokeAPIKey(user, keyID)
+}
+
+// CreateServiceAccount creates a user for a bot or integration. Service
+// accounts cannot log in with a password and authenticate with API keys only.
+func CreateServiceAccount(username string) (ServiceAccountResponse, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return ServiceAccountResponse{}, errors.New("username is required")
+	}
+	// Service accounts receive no email; a reserved domain keeps the address unique and undeliverable.
+	user, err := db.InsertServiceAccount(username, username+"@service-accounts.invalid")
+	if err != nil {
+		return ServiceAccountResponse{}, err
+	}
+	return ServiceAccountResponse{ID: user.ID, Username: user.Username}, nil
+}
+
+// GetServiceAccounts lists every service account.
+func GetServiceAccounts() ([]ServiceAccountResponse, error) {
+	users, err := db.GetServiceAccounts()
+	if err != nil {
+		return nil, err
+	}
+	accounts := []ServiceAccountResponse{}
+	for _, user := range users {
+		accounts = append(accounts, ServiceAccountResponse{ID: user.ID, Username: user.Username})
+	}
+	return accounts, nil
+}
+
+// CreateServiceAccountAPIKey creates an API key for a service account.
+func CreateServiceAccountAPIKey(accountID string, input CreateAPIKeyInput) (CreatedAPIKeyResponse, error) {
+	account, err := getServiceAccount(accountID)
+	if err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	return createAPIKey(account, input)
+}
+
+// GetServiceAccountAPIKeys lists a service account's API keys.
+func GetServiceAccountAPIKeys(accountID string) (GetAPIKeysResponse, error) {
+	account, err := getServiceAccount(accountID)
+	if err != nil {
+		return GetAPIKeysResponse{}, err
+	}
+	return getAPIKeys(account)
+}
+
+// RotateServiceAccountAPIKey issues a new secret for one of a service account's API keys.
+func RotateServiceAccountAPIKey(accountID, keyID string) (CreatedAPIKeyResponse, error) {
+	account, err := getServiceAccount(accountID)
+	if err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	return rotateAPIKey(account, keyID)
+}
+
+// RevokeServiceAccountAPIKey revokes one of a service account's API keys.
+func RevokeServiceAccountAPIKey(accountID, keyID string) error {
+	account, err := getServiceAccount(accountID)
+	if err != nil {
+		return err
+	}
+	return revokeAPIKey(account, keyID)
+}
+
+func getServiceAccount(accountID string) (*db.User, error) {
+	user, err := db.GetUserByID(accountID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !user.IsServiceAccount) {
+		return nil, ErrServiceAccountNotFound
+	}
+	return user, err
+}
+
+func createAPIKey(user *db.User, input CreateAPIKeyInput) (CreatedAPIKeyResponse, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return CreatedAPIKeyResponse{}, errors.New("name is required")
+	}
+	if len(input.Scopes) == 0 {
+		return CreatedAPIKeyResponse{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, scope := range input.Scopes {
+		if !auth.ValidScope(scope) {
+			return CreatedAPIKeyResponse{}, fmt.Errorf("%w: unknown scope %q", ErrInvalidScope, scope)
+		}
+		if scope == auth.ScopeAdmin && !user.IsAdmin {
+			return CreatedAPIKeyResponse{}, ErrAdminScopeNotAllowed
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	key := db.APIKey{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			return CreatedAPIKeyResponse{}, ErrInvalidExpiry
+		}
+		key.ExpiresAt = sql.NullTime{Time: *input.ExpiresAt, Valid: true}
+	}
+
+	value, err := generateAPIKey()
+	if err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	key.Prefix = value[:apiKeyDisplayLength]
+	if err := db.InsertAPIKey(key, auth.HashToken(value)); err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	return CreatedAPIKeyResponse{APIKeyResponse: apiKeyResponse(&key), Key: value}, nil
+}
+
+func getAPIKeys(user *db.User) (GetAPIKeysResponse, error) {
+	keys, err := db.GetUserAPIKeys(user.ID)
+	if err != nil {
+		return GetAPIKeysResponse{}, err
+	}
+	responses := []APIKeyResponse{}
+	for _, key := range keys {
+		responses = append(responses, apiKeyResponse(key))
+	}
+	return GetAPIKeysResponse{APIKeys: responses, Count: len(responses)}, nil
+}
+
+func rotateAPIKey(user *db.User, keyID string) (CreatedAPIKeyResponse, error) {
+	key, err := db.GetUserAPIKey(user.ID, keyID)
+	if err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	value, err := generateAPIKey()
+	if err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	key.Prefix = value[:apiKeyDisplayLength]
+	key.LastUsedAt = sql.NullTime{}
+	if err := db.RotateAPIKey(user.ID, key.ID, key.Prefix, auth.HashToken(value)); err != nil {
+		return CreatedAPIKeyResponse{}, err
+	}
+	// WebSocket connections opened with the old secret are closed.
+	notifier.DisconnectSession(key.ID)
+	return CreatedAPIKeyResponse{APIKeyResponse: apiKeyResponse(key), Key: value}, nil
+}
+
+// revokeAPIKey revokes the key and closes the WebSocket connections opened with it.
+func revokeAPIKey(user *db.User, keyID string) error {
+	if err := db.RevokeAPIKey(user.ID, keyID); err != nil {
+		return err
+	}
+	notifier.DisconnectSession(keyID)
+	return nil
+}
+
+func generateAPIKey() (string, error) {
+	secret, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	return auth.APIKeyPrefix + secret, nil
+}
+
+func apiKeyResponse(key *db.APIKey) APIKeyResponse {
+	response := APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if key.LastUsedAt.Valid {
+		response.LastUsedAt = &key.LastUsedAt.Time
+	}
+	if key.ExpiresAt.Valid {
+		response.ExpiresAt = &key.ExpiresAt.Time
+	}
+	return response
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -17,76 +19,241 @@ type CreateChatInput struct {
 
 // ChatResponse represents the data returned after creating or retrieving a chat.
 type ChatResponse struct {
-	ID      string   `json:"id"`
-	Title   string   `json:"title"`
-	UserIDs []string `json:"user_ids"`
-	IsGroup bool     `json:"is_group"`
+	ID          string               `json:"id"`
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	AvatarURL   string               `json:"avatar_url"`
+	UserIDs     []string             `json:"user_ids"`
+	Members     []ChatMemberResponse `json:"members"`
+	IsGroup     bool                 `json:"is_group"`
+	ArchivedAt  *time.Time           `json:"archived_at,omitempty"`
+	// UnreadCount and Mentioned describe what the caller has not read yet.
+	// They are filled in when listing the caller's chats.
+	UnreadCount int  `json:"unread_count"`
+	Mentioned   bool `json:"mentioned"`
+}
+
+// ChatMemberResponse represents a member of a chat.
+type ChatMemberResponse struct {
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	// LastReadMessageID is the latest message the member has read.
+	LastReadMessageID string `json:"last_read_message_id,omitempty"`
+}
+
+// chatMemberResponse converts a chat member to its response format.
+func chatMemberResponse(member db.ChatMember) ChatMemberResponse {
+	response := ChatMemberResponse{
+		UserID:   member.UserID,
+		Username: member.Username,
+		Role:     member.Role,
+		JoinedAt: member.JoinedAt,
+	}
+	if member.LastReadMessageID > 0 {
+		response.LastReadMessageID = strconv.FormatInt(member.LastReadMessageID, 10)
+	}
+	return response
+}
+
+// chatResponse converts a chat to its response format as seen by the given
+// user. One-to-one chats are titled after the other participant.
+func chatResponse(chat *db.Chat, viewerID string) ChatResponse {
+	title := chat.Title
+	direct := !chat.IsGroup && len(chat.Members) == 2
+	members := []ChatMemberResponse{}
+	for _, member := range chat.Members {
+		members = append(members, chatMemberResponse(member))
+		if direct && member.UserID != viewerID {
+			title = member.Username
+		}
+	}
+	response := ChatResponse{
+		ID:          chat.ID,
+		Title:       title,
+		Description: chat.Description,
+		AvatarURL:   chat.AvatarURL,
+		UserIDs:     chat.UserIDs,
+		Members:     members,
+		IsGroup:     chat.IsGroup,
+	}
+	if chat.ArchivedAt.Valid {
+		response.ArchivedAt = &chat.ArchivedAt.Time
+	}
+	return response
 }
 
 // MessageResponse represents a single message in the chat.
 type MessageResponse struct {
-	ID        string    `json:"id"`
-	ChatID    string    `json:"chat_id"`
-	UserID    string    `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `json:"id"`
+	ChatID    string     `json:"chat_id"`
+	UserID    string     `json:"user_id"`
+	Username  string     `json:"username"`
+	Kind      string     `json:"kind"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	// DeletedAt and DeletedBy mark a deleted message, whose content is empty.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	// ReplyToID is the message quoted by a reply, and ThreadRootID the first
+	// message of its thread.
+	ReplyToID    string `json:"reply_to_id,omitempty"`
+	ThreadRootID string `json:"thread_root_id,omitempty"`
+	// ReplyCount and LastReplyAt describe the thread started by this message.
+	ReplyCount  int        `json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+	// ClientMsgID is the sender's own ID for a message that was just sent.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// Reactions is filled in where messages are listed for a user.
+	Reactions []ReactionResponse `json:"reactions,omitempty"`
+}
+
+// messageResponse converts a message to its response format.
+func messageResponse(msg *db.Message) MessageResponse {
+	response := MessageResponse{
+		ID:        strconv.FormatInt(msg.ID, 10),
+		ChatID:    strconv.FormatInt(msg.ChatID, 10),
+		UserID:    strconv.FormatInt(msg.UserID, 10),
+		Username:  msg.Username,
+		Kind:      msg.Kind,
+		Content:   msg.Content,
+		CreatedAt: msg.CreatedAt,
+		UpdatedAt: msg.UpdatedAt,
+	}
+	if msg.EditedAt.Valid {
+		response.EditedAt = &msg.EditedAt.Time
+	}
+	if msg.DeletedAt.Valid {
+		response.DeletedAt = &msg.DeletedAt.Time
+		response.DeletedBy = strconv.FormatInt(msg.DeletedBy.Int64, 10)
+	}
+	if msg.ReplyToID.Valid {
+		response.ReplyToID = strconv.FormatInt(msg.ReplyToID.Int64, 10)
+	}
+	if msg.ThreadRootID.Valid {
+		response.ThreadRootID = strconv.FormatInt(msg.ThreadRootID.Int64, 10)
+	}
+	if msg.ClientMsgID.Valid {
+		response.ClientMsgID = msg.ClientMsgID.String
+	}
+	if msg.ReplyCount > 0 {
+		response.ReplyCount = msg.ReplyCount
+		response.LastReplyAt = &msg.LastReplyAt.Time
+	}
+	return response
 }
 
 // GetChatMessagesResponse represents the data returned when retrieving messages for a chat.
+// PrevCursor fetches older messages and NextCursor newer ones; each is empty
+// when there are no more messages in that direction.
 type GetChatMessagesResponse struct {
-	Messages []MessageResponse `json:"messages"`
-	Count    int               `json:"count"`
+	Messages   []MessageResponse `json:"messages"`
+	Count      int               `json:"count"`
+	PrevCursor string            `json:"prev_cursor,omitempty"`
+	NextCursor string            `json:"next_cursor,omitempty"`
 }
 
-// CreateChat processes the creation of a new chat and interacts with the database.
-func CreateChat(input CreateChatInput) (ChatResponse, error) {
+// ErrInvalidDirectChat is returned when a one-to-one chat is requested with
+// anyone other than exactly one other user.
+var ErrInvalidDirectChat = errors.New("a direct chat needs exactly one other user")
+
+// CreateChat processes the creation of a new chat by the given user and interacts with the database.
+// The creator becomes the chat's owner; input.UserIDs lists the other members.
+// A chat that is not a group is a direct chat with exactly one other user; the
+// existing one is returned if the pair already has one.
+func CreateChat(username string, input CreateChatInput) (ChatResponse, error) {
+	if !input.IsGroup {
+		if len(input.UserIDs) != 1 {
+			return ChatResponse{}, ErrInvalidDirectChat
+		}
+		chat, _, err := GetOrCreateDirectChat(username, input.UserIDs[0])
+		return chat, err
+	}
 	if input.Title == "" {
 		return ChatResponse{}, errors.New("chat title is required")
 	}
-	chat, err := db.InsertChat(input.Title, input.UserIDs, input.IsGroup)
+	user, err := db.GetUserByUsername(username)
 	if err != nil {
 		return ChatResponse{}, err
 	}
-	return ChatResponse{
-		ID:      chat.ID,
-		Title:   chat.Title,
-		UserIDs: chat.UserIDs,
-		IsGroup: chat.IsGroup,
-	}, nil
+	if err := requireVerifiedEmail(user); err != nil {
+		return ChatResponse{}, err
+	}
+	chat, err := db.InsertChat(input.Title, user.ID, input.UserIDs, input.IsGroup)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	return chatResponse(chat, user.ID), nil
 }
 
-// GetChat retrieves all messages for a chat by ID from the database.
-func GetChat(id string) (GetChatMessagesResponse, error) {
-	// First verify that the chat exists
-	_, err := db.GetChatByID(id)
+// GetOrCreateDirectChat returns the user's one-to-one chat with another user,
+// creating it if needed. The returned flag reports whether it was created.
+func GetOrCreateDirectChat(username, otherUserID string) (ChatResponse, bool, error) {
+	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		return GetChatMessagesResponse{}, err
+		return ChatResponse{}, false, err
+	}
+	if err := requireVerifiedEmail(user); err != nil {
+		return ChatResponse{}, false, err
+	}
+	other, err := db.GetUserByID(otherUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChatResponse{}, false, fmt.Errorf("%w: %s", db.ErrUserNotFound, otherUserID)
+	}
+	if err != nil {
+		return ChatResponse{}, false, err
+	}
+	if other.ID == user.ID {
+		return ChatResponse{}, false, ErrInvalidDirectChat
 	}
 
-	// Get all messages for the chat
-	messages, err := db.GetMessagesByChatID(id)
+	chat, created, err := db.GetOrCreateDirectChat(user.ID, other.ID)
+	if err != nil {
+		return ChatResponse{}, false, err
+	}
+	return chatResponse(chat, user.ID), created, nil
+}
+
+// GetChat retrieves a page of a chat's messages, oldest first. Without a
+// cursor or time it returns the latest messages. Deleted messages appear as
+// tombstones; messages the caller has hidden are left out.
+func GetChat(access *ChatAccess, query MessageQuery) (GetChatMessagesResponse, error) {
+	filter := db.MessageFilter{ChatID: access.ChatID, UserID: access.User.ID, FoldThreads: query.FoldThreads}
+	return getMessagePage(filter, query)
+}
+
+// getMessagePage retrieves the page of the filtered messages selected by the query.
+func getMessagePage(filter db.MessageFilter, query MessageQuery) (GetChatMessagesResponse, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultMessagePageSize
+	}
+	if limit < 0 || limit > maxMessagePageSize {
+		return GetChatMessagesResponse{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidMessageQuery, maxMessagePageSize)
+	}
+
+	page, err := loadMessagePage(filter, query, limit)
 	if err != nil {
 		return GetChatMessagesResponse{}, err
 	}
 
-	// Convert to response format
-	var messageResponses []MessageResponse
-	for _, msg := range messages {
-		messageResponses = append(messageResponses, MessageResponse{
-			ID:        strconv.FormatInt(msg.ID, 10),
-			ChatID:    strconv.FormatInt(msg.ChatID, 10),
-			UserID:    strconv.FormatInt(msg.UserID, 10),
-			Content:   msg.Content,
-			CreatedAt: msg.CreatedAt,
-			UpdatedAt: msg.UpdatedAt,
-		})
-	}
-
-	return GetChatMessagesResponse{
-		Messages: messageResponses,
-		Count:    len(messageResponses),
-	}, nil
+	messages, err := messageResponses(page.messages, filter.UserID)
+	if err != nil {
+		return GetChatMessagesResponse{}, err
+	}
+	response := GetChatMessagesResponse{Messages: messages, Count: len(messages)}
+	if n := len(page.messages); n > 0 {
+		if page.hasOlder {
+			response.PrevCursor = encodeMessageCursor(page.messages[0].ID)
+		}
+		if page.hasNewer {
+			response.NextCursor = encodeMessageCursor(page.messages[n-1].ID)
+		}
+	}
+	return response, nil
 }
 
 // GetUserChatsResponse represents the data returned when retrieving a user's chats.
@@ -95,8 +262,10 @@ type GetUserChatsResponse struct {
 	Count int            `json:"count"`
 }
 
-// GetUserChats retrieves all chats where the specified user is a participant.
-func GetUserChats(username string) (GetUserChatsResponse, error) {
+// GetUserChats retrieves all chats where the specified user is a participant,
+// with the number of messages the user has not read in each.
+// Archived chats are included only if includeArchived is set.
+func GetUserChats(username string, includeArchived bool) (GetUserChatsResponse, error) {
 	// Get the user by username
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
@@ -104,7 +273,12 @@ func GetUserChats(username string) (GetUserChatsResponse, error) {
 	}
 
 	// Get all chats for the user
-	chats, err := db.GetChatsByUserID(user.ID)
+	chats, err := db.GetChatsByUserID(user.ID, includeArchived)
+	if err != nil {
+		return GetUserChatsResponse{}, err
+	}
+
+	unread, err := db.GetUnreadStates(user.ID)
 	if err != nil {
 		return GetUserChatsResponse{}, err
 	}
@@ -112,12 +286,10 @@ func GetUserChats(username string) (GetUserChatsResponse, error) {
 	// Convert to response format
 	var chatResponses []ChatResponse
 	for _, chat := range chats {
-		chatResponses = append(chatResponses, ChatResponse{
-			ID:      chat.ID,
-			Title:   chat.Title,
-			UserIDs: chat.UserIDs,
-			IsGroup: chat.IsGroup,
-		})
+		response := chatResponse(chat, user.ID)
+		response.UnreadCount = unread[chat.ID].Count
+		response.Mentioned = unread[chat.ID].Mentioned
+		chatResponses = append(chatResponses, response)
 	}
 
 	return GetUserChatsResponse{
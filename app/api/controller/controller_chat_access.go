@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// ChatAccess describes an authorized user's membership of a chat.
+type ChatAccess struct {
+	ChatID string
+	User   *db.User
+	Member *db.ChatMember
+}
+
+// AuthorizeChat checks that the user is a member of the chat. Every
+// chat-scoped request goes through it before reading or posting. It returns
+// db.ErrChatNotFound if the chat does not exist and db.ErrNotChatMember if the
+// user is not a member.
+func AuthorizeChat(username, chatID string) (*ChatAccess, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	member, err := db.GetChatMember(chatID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatAccess{ChatID: chatID, User: user, Member: member}, nil
+}
@@ -0,0 +1,338 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// chatInviteDisplayLength is how many leading characters of a code are kept to help admins recognise it.
+const chatInviteDisplayLength = 6
+
+// Outcomes of accepting an invite.
+const (
+	InviteJoined  = "joined"
+	InvitePending = "pending"
+)
+
+// ErrInvalidMaxUses is returned when an invite's maximum number of uses is negative.
+var ErrInvalidMaxUses = errors.New("max_uses must not be negative")
+
+// CreateChatInviteInput defines the data required to create an invite.
+// A zero MaxUses allows unlimited uses.
+type CreateChatInviteInput struct {
+	ExpiresAt        *time.Time
+	MaxUses          int64
+	RequiresApproval bool
+}
+
+// ChatInviteResponse describes an invite without its code.
+type ChatInviteResponse struct {
+	ID               string     `json:"id"`
+	ChatID           string     `json:"chat_id"`
+	Prefix           string     `json:"prefix"`
+	CreatedBy        string     `json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	MaxUses          *int64     `json:"max_uses,omitempty"`
+	Uses             int64      `json:"uses"`
+	RequiresApproval bool       `json:"requires_approval"`
+}
+
+// CreatedChatInviteResponse includes the invite code, which is shown only once.
+type CreatedChatInviteResponse struct {
+	ChatInviteResponse
+	Code string `json:"code"`
+}
+
+// GetChatInvitesResponse represents the data returned when listing a chat's outstanding invites.
+type GetChatInvitesResponse struct {
+	Invites []ChatInviteResponse `json:"invites"`
+	Count   int                  `json:"count"`
+}
+
+// ChatInvitePreview describes the chat behind an invite code to someone deciding whether to join.
+type ChatInvitePreview struct {
+	ChatID           string     `json:"chat_id"`
+	Title            string     `json:"title"`
+	MemberCount      int        `json:"member_count"`
+	RequiresApproval bool       `json:"requires_approval"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	IsMember         bool       `json:"is_member"`
+}
+
+// AcceptChatInviteResponse reports whether the caller joined or is waiting for approval.
+type AcceptChatInviteResponse struct {
+	Status    string `json:"status"`
+	ChatID    string `json:"chat_id"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ChatInviteUseResponse describes one use of an invite: a join or a join request.
+type ChatInviteUseResponse struct {
+	ID        string     `json:"id"`
+	InviteID  string     `json:"invite_id"`
+	UserID    string     `json:"user_id"`
+	Username  string     `json:"username"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+}
+
+// GetChatInviteUsesResponse represents the data returned when listing invite uses or join requests.
+type GetChatInviteUsesResponse struct {
+	Uses  []ChatInviteUseResponse `json:"uses"`
+	Count int                     `json:"count"`
+}
+
+// CreateChatInvite creates an invite code for a group chat that is not
+// archived. Owners and admins can create invites.
+func CreateChatInvite(access *ChatAccess, input CreateChatInviteInput) (CreatedChatInviteResponse, error) {
+	if _, err := authorizeChatChange(access); err != nil {
+		return CreatedChatInviteResponse{}, err
+	}
+
+	invite := db.ChatInvite{
+		ChatID:           access.ChatID,
+		CreatedBy:        access.User.ID,
+		RequiresApproval: input.RequiresApproval,
+	}
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			return CreatedChatInviteResponse{}, ErrInvalidExpiry
+		}
+		invite.ExpiresAt = sql.NullTime{Time: *input.ExpiresAt, Valid: true}
+	}
+	if input.MaxUses < 0 {
+		return CreatedChatInviteResponse{}, ErrInvalidMaxUses
+	}
+	if input.MaxUses > 0 {
+		invite.MaxUses = sql.NullInt64{Int64: input.MaxUses, Valid: true}
+	}
+
+	code, err := auth.GenerateOpaqueToken(12)
+	if err != nil {
+		return CreatedChatInviteResponse{}, err
+	}
+	invite.Prefix = code[:chatInviteDisplayLength]
+	created, err := db.InsertChatInvite(invite, auth.HashToken(code))
+	if err != nil {
+		return CreatedChatInviteResponse{}, err
+	}
+	return CreatedChatInviteResponse{ChatInviteResponse: chatInviteResponse(created), Code: code}, nil
+}
+
+// GetChatInvites lists the chat's invites that can still be used. Owners and admins can list invites.
+func GetChatInvites(access *ChatAccess) (GetChatInvitesResponse, error) {
+	if !canManageMembers(access.Member.Role) {
+		return GetChatInvitesResponse{}, ErrChatPermissionDenied
+	}
+	invites, err := db.GetChatInvites(access.ChatID)
+	if err != nil {
+		return GetChatInvitesResponse{}, err
+	}
+	now := time.Now()
+	responses := []ChatInviteResponse{}
+	for _, invite := range invites {
+		if invite.Active(now) {
+			responses = append(responses, chatInviteResponse(invite))
+		}
+	}
+	return GetChatInvitesResponse{Invites: responses, Count: len(responses)}, nil
+}
+
+// RevokeChatInvite revokes one of the chat's invites. Owners and admins can
+// revoke invites. Unlike other invite changes this is allowed in archived
+// chats: it only takes a way into the chat away, and writes no system message.
+func RevokeChatInvite(access *ChatAccess, inviteID string) error {
+	if !canManageMembers(access.Member.Role) {
+		return ErrChatPermissionDenied
+	}
+	return db.RevokeChatInvite(access.ChatID, inviteID)
+}
+
+// GetChatInviteUses lists every join and join request made with one of the
+// chat's invites, including revoked and expired ones. Owners and admins can view it.
+func GetChatInviteUses(access *ChatAccess, inviteID string) (GetChatInviteUsesResponse, error) {
+	if !canManageMembers(access.Member.Role) {
+		return GetChatInviteUsesResponse{}, ErrChatPermissionDenied
+	}
+	invite, err := db.GetChatInvite(access.ChatID, inviteID)
+	if err != nil {
+		return GetChatInviteUsesResponse{}, err
+	}
+	uses, err := db.GetChatInviteUses(invite.ID)
+	if err != nil {
+		return GetChatInviteUsesResponse{}, err
+	}
+	return chatInviteUsesResponse(uses), nil
+}
+
+// PreviewChatInvite describes the chat behind an invite code. Any signed-in
+// user holding the code can preview it.
+func PreviewChatInvite(username, code string) (ChatInvitePreview, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return ChatInvitePreview{}, err
+	}
+	invite, err := db.GetActiveChatInvite(auth.HashToken(code))
+	if err != nil {
+		return ChatInvitePreview{}, err
+	}
+	chat, err := db.GetChatByID(invite.ChatID)
+	if err != nil {
+		return ChatInvitePreview{}, err
+	}
+
+	preview := ChatInvitePreview{
+		ChatID:           chat.ID,
+		Title:            chat.Title,
+		MemberCount:      len(chat.Members),
+		RequiresApproval: invite.RequiresApproval,
+	}
+	if invite.ExpiresAt.Valid {
+		preview.ExpiresAt = &invite.ExpiresAt.Time
+	}
+	for _, member := range chat.Members {
+		if member.UserID == user.ID {
+			preview.IsMember = true
+		}
+	}
+	return preview, nil
+}
+
+// AcceptChatInvite joins the chat behind an invite code, or records a join
+// request if the invite requires approval. Archived chats cannot be joined.
+func AcceptChatInvite(username, code string) (AcceptChatInviteResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return AcceptChatInviteResponse{}, err
+	}
+	invite, err := db.GetActiveChatInvite(auth.HashToken(code))
+	if err != nil {
+		return AcceptChatInviteResponse{}, err
+	}
+	chat, err := db.GetChatByID(invite.ChatID)
+	if err != nil {
+		return AcceptChatInviteResponse{}, err
+	}
+	if chat.ArchivedAt.Valid {
+		return AcceptChatInviteResponse{}, db.ErrChatArchived
+	}
+
+	if invite.RequiresApproval {
+		request, err := db.RequestToJoinChat(invite, user.ID)
+		if err != nil {
+			return AcceptChatInviteResponse{}, err
+		}
+		return AcceptChatInviteResponse{Status: InvitePending, ChatID: invite.ChatID, RequestID: request.ID}, nil
+	}
+
+	access := &ChatAccess{ChatID: invite.ChatID, User: user}
+	event := newChatEvent(access, fmt.Sprintf("%s joined using an invite link", user.Username))
+	if err := db.JoinChatWithInvite(invite, user.ID, event); err != nil {
+		return AcceptChatInviteResponse{}, err
+	}
+	notifyInvitedMember(access, user.ID, event)
+	return AcceptChatInviteResponse{Status: InviteJoined, ChatID: invite.ChatID}, nil
+}
+
+// GetJoinRequests lists the chat's join requests awaiting a decision. Owners and admins can list them.
+func GetJoinRequests(access *ChatAccess) (GetChatInviteUsesResponse, error) {
+	if !canManageMembers(access.Member.Role) {
+		return GetChatInviteUsesResponse{}, ErrChatPermissionDenied
+	}
+	requests, err := db.GetPendingJoinRequests(access.ChatID)
+	if err != nil {
+		return GetChatInviteUsesResponse{}, err
+	}
+	return chatInviteUsesResponse(requests), nil
+}
+
+// ApproveJoinRequest adds the requesting user to a chat that is not archived.
+// Owners and admins can approve requests.
+func ApproveJoinRequest(access *ChatAccess, requestID string) error {
+	if _, err := authorizeChatChange(access); err != nil {
+		return err
+	}
+	request, err := db.GetPendingJoinRequest(access.ChatID, requestID)
+	if err != nil {
+		return err
+	}
+
+	event := newChatEvent(access, fmt.Sprintf("%s approved %s's request to join", access.User.Username, request.Username))
+	if err := db.ApproveJoinRequest(request, access.User.ID, event); err != nil {
+		return err
+	}
+	notifyInvitedMember(access, request.UserID, event)
+	return nil
+}
+
+// RejectJoinRequest turns down a join request. Owners and admins can reject
+// requests. Like revoking an invite, this is allowed in archived chats so that
+// pending requests can be cleared; nobody joins and no system message is written.
+func RejectJoinRequest(access *ChatAccess, requestID string) error {
+	if !canManageMembers(access.Member.Role) {
+		return ErrChatPermissionDenied
+	}
+	request, err := db.GetPendingJoinRequest(access.ChatID, requestID)
+	if err != nil {
+		return err
+	}
+	return db.RejectJoinRequest(request, access.User.ID)
+}
+
+// notifyInvitedMember tells the chat's connected clients that a user joined through an invite.
+func notifyInvitedMember(access *ChatAccess, userID string, event *db.Message) {
+	member, err := db.GetChatMember(access.ChatID, userID)
+	if err != nil {
+		log.Printf("failed to look up new member %s of chat %s: %v", userID, access.ChatID, err)
+		return
+	}
+	notifyMemberChange(access, EventMemberAdded, []ChatMemberResponse{chatMemberResponse(*member)}, event)
+}
+
+func chatInviteResponse(invite *db.ChatInvite) ChatInviteResponse {
+	response := ChatInviteResponse{
+		ID:               invite.ID,
+		ChatID:           invite.ChatID,
+		Prefix:           invite.Prefix,
+		CreatedBy:        invite.CreatedBy,
+		CreatedAt:        invite.CreatedAt,
+		Uses:             invite.Uses,
+		RequiresApproval: invite.RequiresApproval,
+	}
+	if invite.ExpiresAt.Valid {
+		response.ExpiresAt = &invite.ExpiresAt.Time
+	}
+	if invite.MaxUses.Valid {
+		response.MaxUses = &invite.MaxUses.Int64
+	}
+	return response
+}
+
+func chatInviteUsesResponse(uses []*db.ChatInviteUse) GetChatInviteUsesResponse {
+	responses := []ChatInviteUseResponse{}
+	for _, use := range uses {
+		response := ChatInviteUseResponse{
+			ID:        use.ID,
+			InviteID:  use.InviteID,
+			UserID:    use.UserID,
+			Username:  use.Username,
+			Status:    use.Status,
+			CreatedAt: use.CreatedAt,
+			DecidedBy: use.DecidedBy.String,
+		}
+		if use.DecidedAt.Valid {
+			response.DecidedAt = &use.DecidedAt.Time
+		}
+		responses = append(responses, response)
+	}
+	return GetChatInviteUsesResponse{Uses: responses, Count: len(responses)}
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// requestToJoin records a join request by the outside user through an invite expiring at expiresAt.
+func (g groupChat) requestToJoin(t *testing.T, expiresAt time.Time) *db.ChatInviteUse {
+	t.Helper()
+	invite, err := db.InsertChatInvite(db.ChatInvite{
+		ChatID:           g.id,
+		Prefix:           "test",
+		CreatedBy:        g.owner.ID,
+		ExpiresAt:        sql.NullTime{Time: expiresAt, Valid: true},
+		RequiresApproval: true,
+	}, "hash")
+	if err != nil {
+		t.Fatalf("failed to create invite: %v", err)
+	}
+	request, err := db.RequestToJoinChat(invite, g.outside.ID)
+	if err != nil {
+		t.Fatalf("failed to request to join: %v", err)
+	}
+	return request
+}
+
+func TestApproveJoinRequest(t *testing.T) {
+	t.Run("active invite", func(t *testing.T) {
+		g := setupGroupChat(t)
+		request := g.requestToJoin(t, time.Now().Add(time.Hour))
+		if err := ApproveJoinRequest(g.access(t, g.admin), request.ID); err != nil {
+			t.Fatalf("ApproveJoinRequest: %v", err)
+		}
+		if role := g.role(t, g.outside); role != db.ChatRoleMember {
+			t.Errorf("approved user has role %q, want %q", role, db.ChatRoleMember)
+		}
+	})
+
+	t.Run("invite expired while the request was pending", func(t *testing.T) {
+		g := setupGroupChat(t)
+		// A time zone east of UTC makes the stored expiry sort after the current UTC time unless it is normalized.
+		request := g.requestToJoin(t, time.Now().Add(-time.Minute).In(time.FixedZone("UTC+10", 10*60*60)))
+		err := ApproveJoinRequest(g.access(t, g.admin), request.ID)
+		if !errors.Is(err, db.ErrInviteNotFound) {
+			t.Fatalf("ApproveJoinRequest = %v, want ErrInviteNotFound", err)
+		}
+		if _, err := db.GetChatMember(g.id, g.outside.ID); !errors.Is(err, db.ErrNotChatMember) {
+			t.Errorf("user joined through an expired invite: %v", err)
+		}
+		if _, err := db.GetPendingJoinRequest(g.id, request.ID); err != nil {
+			t.Errorf("request is no longer pending: %v", err)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// Event types sent to connected clients when a chat itself changes.
+const (
+	EventChatUpdated    = "chat.updated"
+	EventChatArchived   = "chat.archived"
+	EventChatUnarchived = "chat.unarchived"
+	EventChatDeleted    = "chat.deleted"
+)
+
+// maxChatDescriptionLength limits the length of a chat description in bytes.
+const maxChatDescriptionLength = 1000
+
+// ErrInvalidChatUpdate is returned when a chat update has no changes or an invalid value.
+var ErrInvalidChatUpdate = errors.New("invalid chat update")
+
+// UpdateChatInput lists the chat details to change. Nil fields are left unchanged.
+type UpdateChatInput struct {
+	Title       *string
+	Description *string
+	AvatarURL   *string
+}
+
+// ChatEvent is sent to connected clients when a chat's details or state change.
+type ChatEvent struct {
+	ActorID string           `json:"actor_id"`
+	Chat    *ChatResponse    `json:"chat,omitempty"`
+	Message *MessageResponse `json:"message,omitempty"`
+}
+
+// UpdateChat changes a group chat's title, description or avatar. Owners and
+// admins can update a chat that is not archived.
+func UpdateChat(access *ChatAccess, input UpdateChatInput) (ChatResponse, error) {
+	if _, err := authorizeChatChange(access); err != nil {
+		return ChatResponse{}, err
+	}
+
+	var update db.ChatUpdate
+	var changes []string
+	if input.Title != nil {
+		title := strings.TrimSpace(*input.Title)
+		if title == "" {
+			return ChatResponse{}, fmt.Errorf("%w: title must not be empty", ErrInvalidChatUpdate)
+		}
+		update.Title = &title
+		changes = append(changes, fmt.Sprintf("renamed the chat to %q", title))
+	}
+	if input.Description != nil {
+		description := strings.TrimSpace(*input.Description)
+		if len(description) > maxChatDescriptionLength {
+			return ChatResponse{}, fmt.Errorf("%w: description must be at most %d bytes", ErrInvalidChatUpdate, maxChatDescriptionLength)
+		}
+		update.Description = &description
+		changes = append(changes, "changed the description")
+	}
+	if input.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*input.AvatarURL)
+		if avatarURL != "" && !validAvatarURL(avatarURL) {
+			return ChatResponse{}, fmt.Errorf("%w: avatar_url must be an http or https URL", ErrInvalidChatUpdate)
+		}
+		update.AvatarURL = &avatarURL
+		changes = append(changes, "changed the avatar")
+	}
+	if len(changes) == 0 {
+		return ChatResponse{}, fmt.Errorf("%w: nothing to update", ErrInvalidChatUpdate)
+	}
+
+	content := access.User.Username + " " + changes[0]
+	if n := len(changes); n > 1 {
+		content = access.User.Username + " " + strings.Join(changes[:n-1], ", ") + " and " + changes[n-1]
+	}
+	event := newChatEvent(access, content)
+	if err := db.UpdateChat(access.ChatID, update, event); err != nil {
+		return ChatResponse{}, err
+	}
+	return notifyChatChange(access, EventChatUpdated, event)
+}
+
+// ArchiveChat makes a group chat read-only and hides it from default chat
+// listings. Owners and admins can archive a chat.
+func ArchiveChat(access *ChatAccess) (ChatResponse, error) {
+	if _, err := authorizeChatAdmin(access); err != nil {
+		return ChatResponse{}, err
+	}
+	event := newChatEvent(access, fmt.Sprintf("%s archived the chat", access.User.Username))
+	if err := db.SetChatArchived(access.ChatID, true, event); err != nil {
+		return ChatResponse{}, err
+	}
+	return notifyChatChange(access, EventChatArchived, event)
+}
+
+// UnarchiveChat makes an archived group chat writable again. Owners and admins can unarchive a chat.
+func UnarchiveChat(access *ChatAccess) (ChatResponse, error) {
+	if _, err := authorizeChatAdmin(access); err != nil {
+		return ChatResponse{}, err
+	}
+	event := newChatEvent(access, fmt.Sprintf("%s unarchived the chat", access.User.Username))
+	if err := db.SetChatArchived(access.ChatID, false, event); err != nil {
+		return ChatResponse{}, err
+	}
+	return notifyChatChange(access, EventChatUnarchived, event)
+}
+
+// DeleteChat permanently deletes a group chat with its messages, and closes
+// every connection to it. Owners and admins can delete a chat.
+func DeleteChat(access *ChatAccess) error {
+	if _, err := authorizeChatAdmin(access); err != nil {
+		return err
+	}
+	if err := db.DeleteChat(access.ChatID); err != nil {
+		return err
+	}
+	chatID, err := strconv.ParseInt(access.ChatID, 10, 64)
+	if err != nil {
+		return nil
+	}
+	notifier.BroadcastToChat(chatID, EventChatDeleted, ChatEvent{ActorID: access.User.ID})
+	notifier.DisconnectChat(chatID)
+	return nil
+}
+
+// authorizeChatChange returns the chat if the caller may change its details or
+// members: only owners and admins of group chats that are not archived can.
+func authorizeChatChange(access *ChatAccess) (*db.Chat, error) {
+	chat, err := authorizeChatAdmin(access)
+	if err != nil {
+		return nil, err
+	}
+	if chat.ArchivedAt.Valid {
+		return nil, db.ErrChatArchived
+	}
+	return chat, nil
+}
+
+// authorizeChatAdmin returns the chat if the caller may archive, unarchive or
+// delete it: only owners and admins of group chats can.
+func authorizeChatAdmin(access *ChatAccess) (*db.Chat, error) {
+	if !canManageMembers(access.Member.Role) {
+		return nil, ErrChatPermissionDenied
+	}
+	chat, err := db.GetChatByID(access.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.IsGroup {
+		return nil, ErrNotGroupChat
+	}
+	return chat, nil
+}
+
+// notifyChatChange tells the chat's connected clients about a change to the chat and returns the updated chat.
+func notifyChatChange(access *ChatAccess, eventType string, event *db.Message) (ChatResponse, error) {
+	chat, err := db.GetChatByID(access.ChatID)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	response := chatResponse(chat, access.User.ID)
+	message := messageResponse(event)
+	notifier.BroadcastToChat(event.ChatID, eventType, ChatEvent{ActorID: access.User.ID, Chat: &response, Message: &message})
+	return response, nil
+}
+
+func validAvatarURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
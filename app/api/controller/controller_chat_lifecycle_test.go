@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+func TestArchivedChatRefusesChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, g groupChat, code, requestID string) error
+	}{
+		{
+			name: "update",
+			change: func(t *testing.T, g groupChat, _, _ string) error {
+				title := "renamed"
+				_, err := UpdateChat(g.access(t, g.owner), UpdateChatInput{Title: &title})
+				return err
+			},
+		},
+		{
+			name: "add members",
+			change: func(t *testing.T, g groupChat, _, _ string) error {
+				_, err := AddChatMembers(g.access(t, g.admin), []string{g.outside.ID})
+				return err
+			},
+		},
+		{
+			name: "remove member",
+			change: func(t *testing.T, g groupChat, _, _ string) error {
+				return RemoveChatMember(g.access(t, g.admin), g.member.ID)
+			},
+		},
+		{
+			name: "set role",
+			change: func(t *testing.T, g groupChat, _, _ string) error {
+				return SetChatMemberRole(g.access(t, g.owner), g.member.ID, db.ChatRoleAdmin)
+			},
+		},
+		{
+			name: "transfer ownership",
+			change: func(t *testing.T, g groupChat, _, _ string) error {
+				return TransferChatOwnership(g.access(t, g.owner), g.member.ID)
+			},
+		},
+		{
+			name: "create invite",
+			change: func(t *testing.T, g groupChat, _, _ string) error {
+				_, err := CreateChatInvite(g.access(t, g.admin), CreateChatInviteInput{})
+				return err
+			},
+		},
+		{
+			name: "accept invite",
+			change: func(t *testing.T, g groupChat, code, _ string) error {
+				_, err := AcceptChatInvite(g.outside.Username, code)
+				return err
+			},
+		},
+		{
+			name: "approve join request",
+			change: func(t *testing.T, g groupChat, _, requestID string) error {
+				return ApproveJoinRequest(g.access(t, g.admin), requestID)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := setupGroupChat(t)
+			invite, err := CreateChatInvite(g.access(t, g.owner), CreateChatInviteInput{})
+			if err != nil {
+				t.Fatalf("CreateChatInvite: %v", err)
+			}
+			request := g.requestToJoin(t, time.Now().Add(time.Hour))
+			if _, err := ArchiveChat(g.access(t, g.owner)); err != nil {
+				t.Fatalf("ArchiveChat: %v", err)
+			}
+
+			if err := tt.change(t, g, invite.Code, request.ID); !errors.Is(err, db.ErrChatArchived) {
+				t.Fatalf("change = %v, want ErrChatArchived", err)
+			}
+			if _, err := db.GetChatMember(g.id, g.outside.ID); !errors.Is(err, db.ErrNotChatMember) {
+				t.Errorf("user joined the archived chat: %v", err)
+			}
+			if role := g.role(t, g.member); role != db.ChatRoleMember {
+				t.Errorf("member has role %q, want %q", role, db.ChatRoleMember)
+			}
+
+			if _, err := UnarchiveChat(g.access(t, g.owner)); err != nil {
+				t.Fatalf("UnarchiveChat: %v", err)
+			}
+			if err := tt.change(t, g, invite.Code, request.ID); err != nil {
+				t.Errorf("change after unarchiving: %v", err)
+			}
+		})
+	}
+}
+
+func TestArchivedChatAllowsClosingInvites(t *testing.T) {
+	g := setupGroupChat(t)
+	invite, err := CreateChatInvite(g.access(t, g.owner), CreateChatInviteInput{})
+	if err != nil {
+		t.Fatalf("CreateChatInvite: %v", err)
+	}
+	request := g.requestToJoin(t, time.Now().Add(time.Hour))
+	if _, err := ArchiveChat(g.access(t, g.owner)); err != nil {
+		t.Fatalf("ArchiveChat: %v", err)
+	}
+
+	if err := RevokeChatInvite(g.access(t, g.admin), invite.ID); err != nil {
+		t.Errorf("RevokeChatInvite: %v", err)
+	}
+	if err := RejectJoinRequest(g.access(t, g.admin), request.ID); err != nil {
+		t.Errorf("RejectJoinRequest: %v", err)
+	}
+	if _, err := db.GetChatMember(g.id, g.outside.ID); !errors.Is(err, db.ErrNotChatMember) {
+		t.Errorf("rejected user joined the chat: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// Event types sent to connected clients when a chat's membership changes.
+const (
+	EventMemberAdded          = "member.added"
+	EventMemberRemoved        = "member.removed"
+	EventMemberLeft           = "member.left"
+	EventMemberRoleChanged    = "member.role_changed"
+	EventOwnershipTransferred = "chat.ownership_transferred"
+)
+
+// ErrChatPermissionDenied is returned when the caller's role does not allow the change.
+var ErrChatPermissionDenied = db.ErrChatPermissionDenied
+
+// ErrNotGroupChat is returned when adding members to, or changing, a chat that is not a group.
+var ErrNotGroupChat = errors.New("this change is only possible in group chats")
+
+// ErrOwnerMustTransfer is returned when the owner leaves a chat that still has other members.
+var ErrOwnerMustTransfer = db.ErrOwnerMustTransfer
+
+// ErrInvalidChatRole is returned when assigning a role other than admin or member.
+var ErrInvalidChatRole = errors.New("role must be admin or member")
+
+// ErrInvalidMemberTarget is returned when a member change targets the caller or the owner.
+var ErrInvalidMemberTarget = errors.New("this change cannot be applied to that member")
+
+// GetChatMembersResponse represents the data returned when listing a chat's members.
+type GetChatMembersResponse struct {
+	Members []ChatMemberResponse `json:"members"`
+	Count   int                  `json:"count"`
+}
+
+// ChatMemberEvent is sent to connected clients when a chat's membership changes.
+type ChatMemberEvent struct {
+	ActorID string               `json:"actor_id"`
+	Members []ChatMemberResponse `json:"members"`
+	Message MessageResponse      `json:"message"`
+}
+
+// GetChatMembers lists the members of the chat.
+func GetChatMembers(access *ChatAccess) (GetChatMembersResponse, error) {
+	chat, err := db.GetChatByID(access.ChatID)
+	if err != nil {
+		return GetChatMembersResponse{}, err
+	}
+	members := []ChatMemberResponse{}
+	for _, member := range chat.Members {
+		members = append(members, chatMemberResponse(member))
+	}
+	return GetChatMembersResponse{Members: members, Count: len(members)}, nil
+}
+
+// AddChatMembers adds users to a group chat that is not archived. Owners and
+// admins can add members; the role is checked again when the members are
+// written. Repeated user IDs are added once.
+func AddChatMembers(access *ChatAccess, userIDs []string) (GetChatMembersResponse, error) {
+	if _, err := authorizeChatChange(access); err != nil {
+		return GetChatMembersResponse{}, err
+	}
+	if len(userIDs) == 0 {
+		return GetChatMembersResponse{}, errors.New("user_ids is required")
+	}
+
+	var ids, names []string
+	seen := make(map[string]bool)
+	for _, userID := range userIDs {
+		user, err := db.GetUserByID(userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return GetChatMembersResponse{}, fmt.Errorf("%w: %s", db.ErrUserNotFound, userID)
+		}
+		if err != nil {
+			return GetChatMembersResponse{}, err
+		}
+		if seen[user.ID] {
+			continue
+		}
+		seen[user.ID] = true
+		ids = append(ids, user.ID)
+		names = append(names, user.Username)
+	}
+
+	event := newChatEvent(access, fmt.Sprintf("%s added %s", access.User.Username, strings.Join(names, ", ")))
+	if err := db.AddChatMembers(access.ChatID, access.User.ID, ids, event); err != nil {
+		return GetChatMembersResponse{}, err
+	}
+
+	members, err := GetChatMembers(access)
+	if err != nil {
+		return GetChatMembersResponse{}, err
+	}
+	var added []ChatMemberResponse
+	for _, member := range members.Members {
+		for _, id := range ids {
+			if member.UserID == id {
+				added = append(added, member)
+			}
+		}
+	}
+	notifyMemberChange(access, EventMemberAdded, added, event)
+	return members, nil
+}
+
+// RemoveChatMember removes a member from a group chat that is not archived and
+// closes their connections to it. Owners can remove anyone else; admins can
+// remove members. Both roles are checked when the member is removed.
+func RemoveChatMember(access *ChatAccess, userID string) error {
+	if userID == access.User.ID {
+		return fmt.Errorf("%w: use leave to remove yourself", ErrInvalidMemberTarget)
+	}
+	if _, err := authorizeChatChange(access); err != nil {
+		return err
+	}
+	target, err := db.GetChatMember(access.ChatID, userID)
+	if err != nil {
+		return err
+	}
+
+	event := newChatEvent(access, fmt.Sprintf("%s removed %s", access.User.Username, target.Username))
+	if err := db.RemoveChatMember(access.ChatID, access.User.ID, userID, event); err != nil {
+		return err
+	}
+	notifyMemberChange(access, EventMemberRemoved, []ChatMemberResponse{chatMemberResponse(*target)}, event)
+	disconnectChatMember(access.ChatID, userID)
+	return nil
+}
+
+// LeaveChat removes the caller from the chat. The owner must transfer
+// ownership first unless they are the last member.
+func LeaveChat(access *ChatAccess) error {
+	event := newChatEvent(access, fmt.Sprintf("%s left the chat", access.User.Username))
+	if err := db.LeaveChat(access.ChatID, access.User.ID, event); err != nil {
+		return err
+	}
+	notifyMemberChange(access, EventMemberLeft, []ChatMemberResponse{chatMemberResponse(*access.Member)}, event)
+	disconnectChatMember(access.ChatID, access.User.ID)
+	return nil
+}
+
+// SetChatMemberRole promotes a member to admin or demotes an admin to member in
+// a group chat that is not archived. Only the owner can change roles; this is
+// checked again when the role is written.
+func SetChatMemberRole(access *ChatAccess, userID, role string) error {
+	if role != db.ChatRoleAdmin && role != db.ChatRoleMember {
+		return ErrInvalidChatRole
+	}
+	if access.Member.Role != db.ChatRoleOwner {
+		return ErrChatPermissionDenied
+	}
+	if _, err := authorizeChatChange(access); err != nil {
+		return err
+	}
+	if userID == access.User.ID {
+		return fmt.Errorf("%w: transfer ownership to change your own role", ErrInvalidMemberTarget)
+	}
+	target, err := db.GetChatMember(access.ChatID, userID)
+	if err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf("%s made %s an admin", access.User.Username, target.Username)
+	if role == db.ChatRoleMember {
+		content = fmt.Sprintf("%s removed %s as admin", access.User.Username, target.Username)
+	}
+	event := newChatEvent(access, content)
+	if err := db.SetChatMemberRole(access.ChatID, access.User.ID, userID, role, event); err != nil {
+		return err
+	}
+	target.Role = role
+	notifyMemberChange(access, EventMemberRoleChanged, []ChatMemberResponse{chatMemberResponse(*target)}, event)
+	return nil
+}
+
+// TransferChatOwnership makes another member the owner of a group chat that is
+// not archived. The previous owner becomes an admin.
+func TransferChatOwnership(access *ChatAccess, userID string) error {
+	if access.Member.Role != db.ChatRoleOwner {
+		return ErrChatPermissionDenied
+	}
+	if _, err := authorizeChatChange(access); err != nil {
+		return err
+	}
+	if userID == access.User.ID {
+		return fmt.Errorf("%w: you already own this chat", ErrInvalidMemberTarget)
+	}
+	target, err := db.GetChatMember(access.ChatID, userID)
+	if err != nil {
+		return err
+	}
+
+	event := newChatEvent(access, fmt.Sprintf("%s transferred ownership to %s", access.User.Username, target.Username))
+	if err := db.TransferChatOwnership(access.ChatID, access.User.ID, userID, event); err != nil {
+		return err
+	}
+	previous := *access.Member
+	previous.Role = db.ChatRoleAdmin
+	target.Role = db.ChatRoleOwner
+	notifyMemberChange(access, EventOwnershipTransferred, []ChatMemberResponse{chatMemberResponse(*target), chatMemberResponse(previous)}, event)
+	return nil
+}
+
+func canManageMembers(role string) bool {
+	return role == db.ChatRoleOwner || role == db.ChatRoleAdmin
+}
+
+// newChatEvent builds the system message recording a change made by the caller.
+func newChatEvent(access *ChatAccess, content string) *db.Message {
+	chatID, _ := strconv.ParseInt(access.ChatID, 10, 64)
+	userID, _ := strconv.ParseInt(access.User.ID, 10, 64)
+	return &db.Message{ChatID: chatID, UserID: userID, Username: access.User.Username, Content: content}
+}
+
+// notifyMemberChange tells the chat's connected clients about a membership change.
+func notifyMemberChange(access *ChatAccess, eventType string, members []ChatMemberResponse, event *db.Message) {
+	notifier.BroadcastToChat(event.ChatID, eventType, ChatMemberEvent{
+		ActorID: access.User.ID,
+		Members: members,
+		Message: messageResponse(event),
+	})
+}
+
+// disconnectChatMember closes the user's WebSocket connections to the chat.
+func disconnectChatMember(chatID, userID string) {
+	chat, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return
+	}
+	if user, err := strconv.ParseInt(userID, 10, 64); err == nil {
+		notifier.DisconnectChatMember(chat, user)
+	}
+}
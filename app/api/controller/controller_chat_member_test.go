@@ -0,0 +1,328 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/1akhilpandey/go-messaging/db/dbtest"
+)
+
+// groupChat is a group chat with an owner, an admin and a member, and a user who is not a member yet.
+type groupChat struct {
+	id                            string
+	owner, admin, member, outside *db.User
+}
+
+func setupGroupChat(t *testing.T) groupChat {
+	t.Helper()
+	dbtest.Setup(t)
+	g := groupChat{
+		owner:   insertUser(t, "owner"),
+		admin:   insertUser(t, "admin"),
+		member:  insertUser(t, "member"),
+		outside: insertUser(t, "outside"),
+	}
+	chat, err := db.InsertChat("room", g.owner.ID, []string{g.admin.ID, g.member.ID}, true)
+	if err != nil {
+		t.Fatalf("failed to create chat: %v", err)
+	}
+	g.id = chat.ID
+	if err := db.SetChatMemberRole(g.id, g.owner.ID, g.admin.ID, db.ChatRoleAdmin, nil); err != nil {
+		t.Fatalf("failed to make admin: %v", err)
+	}
+	return g
+}
+
+func insertUser(t *testing.T, username string) *db.User {
+	t.Helper()
+	user, err := db.InsertUser(username, username+"@example.com", "password")
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+// access authorizes the user for the chat as the chat middleware does.
+func (g groupChat) access(t *testing.T, user *db.User) *ChatAccess {
+	t.Helper()
+	access, err := AuthorizeChat(user.Username, g.id)
+	if err != nil {
+		t.Fatalf("failed to authorize %s: %v", user.Username, err)
+	}
+	return access
+}
+
+func (g groupChat) role(t *testing.T, user *db.User) string {
+	t.Helper()
+	member, err := db.GetChatMember(g.id, user.ID)
+	if err != nil {
+		t.Fatalf("failed to look up %s: %v", user.Username, err)
+	}
+	return member.Role
+}
+
+func TestCanManageMembers(t *testing.T) {
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{role: db.ChatRoleOwner, want: true},
+		{role: db.ChatRoleAdmin, want: true},
+		{role: db.ChatRoleMember, want: false},
+		{role: "", want: false},
+		{role: "Owner", want: false},
+	}
+	for _, tt := range tests {
+		if got := canManageMembers(tt.role); got != tt.want {
+			t.Errorf("canManageMembers(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestAddChatMembers(t *testing.T) {
+	t.Run("repeated user IDs are added once", func(t *testing.T) {
+		g := setupGroupChat(t)
+		resp, err := AddChatMembers(g.access(t, g.admin), []string{g.outside.ID, g.outside.ID})
+		if err != nil {
+			t.Fatalf("AddChatMembers: %v", err)
+		}
+		if resp.Count != 4 {
+			t.Errorf("chat has %d members, want 4", resp.Count)
+		}
+		if role := g.role(t, g.outside); role != db.ChatRoleMember {
+			t.Errorf("added user has role %q, want %q", role, db.ChatRoleMember)
+		}
+	})
+
+	t.Run("member cannot add", func(t *testing.T) {
+		g := setupGroupChat(t)
+		_, err := AddChatMembers(g.access(t, g.member), []string{g.outside.ID})
+		if !errors.Is(err, ErrChatPermissionDenied) {
+			t.Errorf("AddChatMembers = %v, want ErrChatPermissionDenied", err)
+		}
+	})
+
+	t.Run("admin demoted after authorization cannot add", func(t *testing.T) {
+		g := setupGroupChat(t)
+		access := g.access(t, g.admin)
+		if err := SetChatMemberRole(g.access(t, g.owner), g.admin.ID, db.ChatRoleMember); err != nil {
+			t.Fatalf("SetChatMemberRole: %v", err)
+		}
+		_, err := AddChatMembers(access, []string{g.outside.ID})
+		if !errors.Is(err, ErrChatPermissionDenied) {
+			t.Errorf("AddChatMembers = %v, want ErrChatPermissionDenied", err)
+		}
+		if _, err := db.GetChatMember(g.id, g.outside.ID); !errors.Is(err, db.ErrNotChatMember) {
+			t.Errorf("user was added despite the denial: %v", err)
+		}
+	})
+
+	t.Run("existing member", func(t *testing.T) {
+		g := setupGroupChat(t)
+		_, err := AddChatMembers(g.access(t, g.owner), []string{g.outside.ID, g.member.ID})
+		if !errors.Is(err, db.ErrAlreadyChatMember) {
+			t.Errorf("AddChatMembers = %v, want ErrAlreadyChatMember", err)
+		}
+		if _, err := db.GetChatMember(g.id, g.outside.ID); !errors.Is(err, db.ErrNotChatMember) {
+			t.Errorf("other users were added despite the failure: %v", err)
+		}
+	})
+}
+
+func TestTransferChatOwnership(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  func(groupChat) *db.User
+		target  func(groupChat) *db.User
+		wantErr error
+	}{
+		{
+			name:   "owner to member",
+			caller: func(g groupChat) *db.User { return g.owner },
+			target: func(g groupChat) *db.User { return g.member },
+		},
+		{
+			name:   "owner to admin",
+			caller: func(g groupChat) *db.User { return g.owner },
+			target: func(g groupChat) *db.User { return g.admin },
+		},
+		{
+			name:    "admin",
+			caller:  func(g groupChat) *db.User { return g.admin },
+			target:  func(g groupChat) *db.User { return g.member },
+			wantErr: ErrChatPermissionDenied,
+		},
+		{
+			name:    "owner to self",
+			caller:  func(g groupChat) *db.User { return g.owner },
+			target:  func(g groupChat) *db.User { return g.owner },
+			wantErr: ErrInvalidMemberTarget,
+		},
+		{
+			name:    "owner to non-member",
+			caller:  func(g groupChat) *db.User { return g.owner },
+			target:  func(g groupChat) *db.User { return g.outside },
+			wantErr: db.ErrNotChatMember,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := setupGroupChat(t)
+			caller, target := tt.caller(g), tt.target(g)
+			callerRole := g.role(t, caller)
+
+			err := TransferChatOwnership(g.access(t, caller), target.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransferChatOwnership = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if role := g.role(t, caller); role != callerRole {
+					t.Errorf("caller's role changed to %q", role)
+				}
+				return
+			}
+			if role := g.role(t, target); role != db.ChatRoleOwner {
+				t.Errorf("new owner has role %q, want %q", role, db.ChatRoleOwner)
+			}
+			if role := g.role(t, caller); role != db.ChatRoleAdmin {
+				t.Errorf("previous owner has role %q, want %q", role, db.ChatRoleAdmin)
+			}
+		})
+	}
+}
+
+func TestLeaveChat(t *testing.T) {
+	t.Run("member", func(t *testing.T) {
+		g := setupGroupChat(t)
+		if err := LeaveChat(g.access(t, g.member)); err != nil {
+			t.Fatalf("LeaveChat: %v", err)
+		}
+		if _, err := db.GetChatMember(g.id, g.member.ID); !errors.Is(err, db.ErrNotChatMember) {
+			t.Errorf("member is still in the chat: %v", err)
+		}
+	})
+
+	t.Run("owner with other members", func(t *testing.T) {
+		g := setupGroupChat(t)
+		if err := LeaveChat(g.access(t, g.owner)); !errors.Is(err, ErrOwnerMustTransfer) {
+			t.Fatalf("LeaveChat = %v, want ErrOwnerMustTransfer", err)
+		}
+		if role := g.role(t, g.owner); role != db.ChatRoleOwner {
+			t.Errorf("owner has role %q, want %q", role, db.ChatRoleOwner)
+		}
+	})
+
+	t.Run("owner after transfer", func(t *testing.T) {
+		g := setupGroupChat(t)
+		if err := TransferChatOwnership(g.access(t, g.owner), g.admin.ID); err != nil {
+			t.Fatalf("TransferChatOwnership: %v", err)
+		}
+		if err := LeaveChat(g.access(t, g.owner)); err != nil {
+			t.Fatalf("LeaveChat: %v", err)
+		}
+		if _, err := db.GetChatMember(g.id, g.owner.ID); !errors.Is(err, db.ErrNotChatMember) {
+			t.Errorf("previous owner is still in the chat: %v", err)
+		}
+	})
+
+	t.Run("last member", func(t *testing.T) {
+		dbtest.Setup(t)
+		owner := insertUser(t, "owner")
+		chat, err := db.InsertChat("solo", owner.ID, nil, true)
+		if err != nil {
+			t.Fatalf("failed to create chat: %v", err)
+		}
+		access, err := AuthorizeChat(owner.Username, chat.ID)
+		if err != nil {
+			t.Fatalf("AuthorizeChat: %v", err)
+		}
+		if err := LeaveChat(access); err != nil {
+			t.Fatalf("LeaveChat: %v", err)
+		}
+	})
+
+	t.Run("twice", func(t *testing.T) {
+		g := setupGroupChat(t)
+		access := g.access(t, g.member)
+		if err := LeaveChat(access); err != nil {
+			t.Fatalf("LeaveChat: %v", err)
+		}
+		if err := LeaveChat(access); !errors.Is(err, db.ErrNotChatMember) {
+			t.Errorf("second LeaveChat = %v, want ErrNotChatMember", err)
+		}
+	})
+}
+
+// TestRolesCheckedOnWrite changes roles after the caller was authorized, as a
+// concurrent request could, and checks that the write still sees the change.
+func TestRolesCheckedOnWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  func(groupChat) *db.User
+		before  func(t *testing.T, g groupChat)
+		change  func(g groupChat, access *ChatAccess) error
+		wantErr error
+	}{
+		{
+			name:   "remove by demoted admin",
+			caller: func(g groupChat) *db.User { return g.admin },
+			before: func(t *testing.T, g groupChat) {
+				if err := SetChatMemberRole(g.access(t, g.owner), g.admin.ID, db.ChatRoleMember); err != nil {
+					t.Fatal(err)
+				}
+			},
+			change:  func(g groupChat, access *ChatAccess) error { return RemoveChatMember(access, g.member.ID) },
+			wantErr: ErrChatPermissionDenied,
+		},
+		{
+			name:   "admin removing promoted member",
+			caller: func(g groupChat) *db.User { return g.admin },
+			before: func(t *testing.T, g groupChat) {
+				if err := SetChatMemberRole(g.access(t, g.owner), g.member.ID, db.ChatRoleAdmin); err != nil {
+					t.Fatal(err)
+				}
+			},
+			change:  func(g groupChat, access *ChatAccess) error { return RemoveChatMember(access, g.member.ID) },
+			wantErr: ErrChatPermissionDenied,
+		},
+		{
+			name:   "set role by previous owner",
+			caller: func(g groupChat) *db.User { return g.owner },
+			before: func(t *testing.T, g groupChat) {
+				if err := TransferChatOwnership(g.access(t, g.owner), g.admin.ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			change: func(g groupChat, access *ChatAccess) error {
+				return SetChatMemberRole(access, g.member.ID, db.ChatRoleAdmin)
+			},
+			wantErr: ErrChatPermissionDenied,
+		},
+		{
+			name:   "leave by new owner",
+			caller: func(g groupChat) *db.User { return g.admin },
+			before: func(t *testing.T, g groupChat) {
+				if err := TransferChatOwnership(g.access(t, g.owner), g.admin.ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			change:  func(g groupChat, access *ChatAccess) error { return LeaveChat(access) },
+			wantErr: ErrOwnerMustTransfer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := setupGroupChat(t)
+			access := g.access(t, tt.caller(g))
+			tt.before(t, g)
+			if err := tt.change(g, access); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("change = %v, want %v", err, tt.wantErr)
+			}
+			// Nobody was removed.
+			for _, user := range []*db.User{g.owner, g.admin, g.member} {
+				g.role(t, user)
+			}
+		})
+	}
+}
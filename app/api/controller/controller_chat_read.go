@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// EventChatRead is sent to connected clients when a member reads a chat up to a message.
+const EventChatRead = "chat.read"
+
+// ReadReceiptEvent is sent to connected clients when a member's read pointer moves forward.
+type ReadReceiptEvent struct {
+	UserID    string `json:"user_id"`
+	MessageID string `json:"message_id"`
+}
+
+// ChatReadResponse represents the caller's read pointer in a chat after marking it read.
+type ChatReadResponse struct {
+	ChatID            string `json:"chat_id"`
+	LastReadMessageID string `json:"last_read_message_id"`
+}
+
+// MarkAllChatsReadResponse represents the data returned after marking every chat read.
+type MarkAllChatsReadResponse struct {
+	// Count is the number of chats that had unread messages.
+	Count int `json:"count"`
+}
+
+// MarkChatRead marks the chat read up to the given message, or up to its
+// latest message if messageID is empty. The read pointer never moves backwards.
+func MarkChatRead(access *ChatAccess, messageID string) (ChatReadResponse, error) {
+	var readID int64
+	if messageID == "" {
+		latest, err := db.GetLatestMessageID(access.ChatID)
+		if err != nil {
+			return ChatReadResponse{}, err
+		}
+		readID = latest
+	} else {
+		msg, err := db.GetMessage(access.ChatID, access.User.ID, messageID)
+		if err != nil {
+			return ChatReadResponse{}, err
+		}
+		readID = msg.ID
+	}
+
+	lastRead, moved, err := db.MarkChatRead(access.ChatID, access.User.ID, readID)
+	if err != nil {
+		return ChatReadResponse{}, err
+	}
+	if moved {
+		chatID, _ := strconv.ParseInt(access.ChatID, 10, 64)
+		notifyChatRead(access.User.ID, db.ReadReceipt{ChatID: chatID, MessageID: lastRead})
+	}
+	return ChatReadResponse{ChatID: access.ChatID, LastReadMessageID: strconv.FormatInt(lastRead, 10)}, nil
+}
+
+// MarkAllChatsRead marks every chat of the user read up to its latest message.
+func MarkAllChatsRead(username string) (MarkAllChatsReadResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return MarkAllChatsReadResponse{}, err
+	}
+	receipts, err := db.MarkAllChatsRead(user.ID)
+	if err != nil {
+		return MarkAllChatsReadResponse{}, err
+	}
+	for _, receipt := range receipts {
+		notifyChatRead(user.ID, receipt)
+	}
+	return MarkAllChatsReadResponse{Count: len(receipts)}, nil
+}
+
+// notifyChatRead tells the chat's connected clients that a member has read it up to a message.
+func notifyChatRead(userID string, receipt db.ReadReceipt) {
+	notifier.BroadcastToChat(receipt.ChatID, EventChatRead, ReadReceiptEvent{
+		UserID:    userID,
+		MessageID: strconv.FormatInt(receipt.MessageID, 10),
+	})
+}
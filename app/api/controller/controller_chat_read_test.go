@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// unread returns the user's unread state of the group chat, as listed by GetUserChats.
+func (g groupChat) unread(t *testing.T, user *db.User) ChatResponse {
+	t.Helper()
+	resp, err := GetUserChats(user.Username, true)
+	if err != nil {
+		t.Fatalf("GetUserChats: %v", err)
+	}
+	for _, chat := range resp.Chats {
+		if chat.ID == g.id {
+			return chat
+		}
+	}
+	t.Fatalf("chat %s is not listed for %s", g.id, user.Username)
+	return ChatResponse{}
+}
+
+func (g groupChat) send(t *testing.T, user *db.User, content string) MessageResponse {
+	t.Helper()
+	access := g.access(t, user)
+	access.User.EmailVerified = true
+	msg, err := SendMessage(access, SendMessageInput{Content: content})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	return msg
+}
+
+func TestUnreadMentions(t *testing.T) {
+	tests := []struct {
+		name          string
+		mention       func(t *testing.T, g groupChat)
+		wantCount     int
+		wantMentioned bool
+	}{
+		{
+			name: "message",
+			mention: func(t *testing.T, g groupChat) {
+				g.send(t, g.admin, "hi @member")
+			},
+			wantCount:     1,
+			wantMentioned: true,
+		},
+		{
+			name: "hidden message",
+			mention: func(t *testing.T, g groupChat) {
+				msg := g.send(t, g.admin, "hi @member")
+				if err := HideMessage(g.access(t, g.member), msg.ID); err != nil {
+					t.Fatalf("HideMessage: %v", err)
+				}
+			},
+		},
+		{
+			name: "deleted message",
+			mention: func(t *testing.T, g groupChat) {
+				msg := g.send(t, g.admin, "hi @member")
+				if _, err := DeleteMessage(g.access(t, g.admin), msg.ID); err != nil {
+					t.Fatalf("DeleteMessage: %v", err)
+				}
+			},
+		},
+		{
+			name: "system message",
+			mention: func(t *testing.T, g groupChat) {
+				title := "@member"
+				if _, err := UpdateChat(g.access(t, g.owner), UpdateChatInput{Title: &title}); err != nil {
+					t.Fatalf("UpdateChat: %v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := setupGroupChat(t)
+			tt.mention(t, g)
+			chat := g.unread(t, g.member)
+			if chat.UnreadCount != tt.wantCount || chat.Mentioned != tt.wantMentioned {
+				t.Errorf("unread_count = %d, mentioned = %v; want %d, %v",
+					chat.UnreadCount, chat.Mentioned, tt.wantCount, tt.wantMentioned)
+			}
+		})
+	}
+}
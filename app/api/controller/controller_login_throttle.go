@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnlockTargetRequired is returned when an unlock request names neither an email nor an IP address.
+var ErrUnlockTargetRequired = errors.New("email or ip_address is required")
+
+// Prefixes of login throttle keys.
+const (
+	throttleKeyEmail = "email:"
+	throttleKeyIP    = "ip:"
+)
+
+// loginThrottleMu serializes updates to the failure counters so concurrent
+// attempts cannot overwrite each other's increments.
+var loginThrottleMu sync.Mutex
+
+// dummyPasswordHash is compared against when the email is unknown, so a failed
+// login takes as long whether or not the account exists.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// loginThrottleKeys returns the throttle keys for a login attempt: one for the
+// email address, whether or not an account uses it, and one for the source IP.
+func loginThrottleKeys(email, ip string) []string {
+	keys := []string{throttleKeyEmail + strings.ToLower(strings.TrimSpace(email))}
+	if ip != "" {
+		keys = append(keys, throttleKeyIP+ip)
+	}
+	return keys
+}
+
+// checkLoginLockout returns a *RateLimitError if any of the keys is locked.
+func checkLoginLockout(keys []string) error {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		throttle, err := db.GetLoginThrottle(key)
+		if err != nil {
+			return err
+		}
+		if d := throttle.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return &RateLimitError{Message: "too many failed login attempts, try again later", RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt against each key and locks keys
+// that reached their threshold. Every failure past the threshold doubles the
+// lockout, up to LoginLockoutMax.
+func recordLoginFailure(keys []string) {
+	loginThrottleMu.Lock()
+	defer loginThrottleMu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		throttle, err := db.GetLoginThrottle(key)
+		if err != nil {
+			log.Printf("failed to record login failure for %s: %v", key, err)
+			continue
+		}
+		if now.Sub(throttle.LastFailureAt) > config.C.LoginFailureWindow {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+
+		threshold := config.C.LoginMaxFailures
+		if strings.HasPrefix(key, throttleKeyIP) {
+			threshold = config.C.LoginIPMaxFailures
+		}
+		if throttle.Failures >= threshold {
+			throttle.LockedUntil = now.Add(lockoutDuration(throttle.Failures - threshold))
+		}
+
+		if err := db.SaveLoginThrottle(throttle); err != nil {
+			log.Printf("failed to record login failure for %s: %v", key, err)
+		}
+	}
+}
+
+// lockoutDuration returns the lockout period after the given number of failures past the threshold.
+func lockoutDuration(excess int) time.Duration {
+	d := config.C.LoginLockoutDuration
+	for i := 0; i < excess && d < config.C.LoginLockoutMax; i++ {
+		d *= 2
+	}
+	if d > config.C.LoginLockoutMax {
+		d = config.C.LoginLockoutMax
+	}
+	return d
+}
+
+// clearLoginFailures resets the account's failure counter after a successful login.
+// The IP counter is left alone so one valid account cannot be used to reset it.
+func clearLoginFailures(email string) {
+	if _, err := db.ClearLoginThrottles(loginThrottleKeys(email, "")...); err != nil {
+		log.Printf("failed to clear login failures: %v", err)
+	}
+}
+
+// UnlockLogin clears failed login attempts and lockouts for an email address,
+// an IP address, or both. It returns the number of counters that were cleared.
+func UnlockLogin(email, ip string) (int64, error) {
+	var keys []string
+	if strings.TrimSpace(email) != "" {
+		keys = append(keys, loginThrottleKeys(email, "")...)
+	}
+	if ip != "" {
+		keys = append(keys, throttleKeyIP+ip)
+	}
+	if len(keys) == 0 {
+		return 0, ErrUnlockTargetRequired
+	}
+	return db.ClearLoginThrottles(keys...)
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/1akhilpandey/go-messaging/db/dbtest"
+)
+
+const throttleTestIP = "192.0.2.1"
+
+// setupLoginThrottle creates a user and configures a lockout after three
+// failures, starting at one minute and capped at four.
+func setupLoginThrottle(t *testing.T) *db.User {
+	t.Helper()
+	dbtest.Setup(t)
+	if _, err := auth.InitKeys("", "test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	saved := *config.C
+	t.Cleanup(func() { *config.C = saved })
+	config.C.LoginMaxFailures = 3
+	config.C.LoginIPMaxFailures = 100
+	config.C.LoginFailureWindow = time.Hour
+	config.C.LoginLockoutDuration = time.Minute
+	config.C.LoginLockoutMax = 4 * time.Minute
+	return insertUser(t, "hank")
+}
+
+func loginWith(user *db.User, password string) error {
+	_, err := LoginUser(user.Email, password, ClientInfo{IPAddress: throttleTestIP})
+	return err
+}
+
+// failLogin makes a login attempt with a wrong password, which must be refused
+// as invalid rather than locked.
+func failLogin(t *testing.T, user *db.User) {
+	t.Helper()
+	err := loginWith(user, "wrong-password")
+	var limited *RateLimitError
+	if err == nil || errors.As(err, &limited) {
+		t.Fatalf("login with a wrong password = %v, want invalid credentials", err)
+	}
+}
+
+// lockedFor returns how long the account is locked, or 0 if the correct password is accepted.
+func lockedFor(t *testing.T, user *db.User) time.Duration {
+	t.Helper()
+	err := loginWith(user, "password")
+	var limited *RateLimitError
+	if errors.As(err, &limited) {
+		return limited.RetryAfter
+	}
+	if err != nil {
+		t.Fatalf("login with the correct password: %v", err)
+	}
+	return 0
+}
+
+// expireLockout ends the account's current lockout without resetting its failure count.
+func expireLockout(t *testing.T, user *db.User) {
+	t.Helper()
+	throttle, err := db.GetLoginThrottle(throttleKeyEmail + user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttle.LockedUntil = time.Now().Add(-time.Second)
+	if err := db.SaveLoginThrottle(throttle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	user := setupLoginThrottle(t)
+	for i := 0; i < config.C.LoginMaxFailures; i++ {
+		failLogin(t, user)
+	}
+
+	// Each failure after a lockout ends doubles the next one, up to the maximum.
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		got := lockedFor(t, user)
+		if got <= want-5*time.Second || got > want {
+			t.Fatalf("locked for %v, want %v", got, want)
+		}
+		expireLockout(t, user)
+		failLogin(t, user)
+	}
+}
+
+func TestLoginSuccessClearsFailures(t *testing.T) {
+	user := setupLoginThrottle(t)
+	for i := 0; i < config.C.LoginMaxFailures-1; i++ {
+		failLogin(t, user)
+	}
+	if d := lockedFor(t, user); d != 0 {
+		t.Fatalf("locked for %v before reaching the limit", d)
+	}
+
+	throttle, err := db.GetLoginThrottle(throttleKeyEmail + user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != 0 {
+		t.Errorf("account has %d failures after a successful login, want 0", throttle.Failures)
+	}
+	// The IP counter is not reset by a successful login.
+	throttle, err = db.GetLoginThrottle(throttleKeyIP + throttleTestIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != config.C.LoginMaxFailures-1 {
+		t.Errorf("IP has %d failures, want %d", throttle.Failures, config.C.LoginMaxFailures-1)
+	}
+
+	// The account gets the full number of attempts again.
+	for i := 0; i < config.C.LoginMaxFailures-1; i++ {
+		failLogin(t, user)
+	}
+	if d := lockedFor(t, user); d != 0 {
+		t.Errorf("locked for %v after failures were cleared", d)
+	}
+}
@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// Event types sent to connected clients when a message changes.
+const (
+	EventMessageCreated = "message.created"
+	EventMessageEdited  = "message.edited"
+	EventMessageDeleted = "message.deleted"
+)
+
+// deletedMessagePurgeInterval is how often the content of deleted messages is
+// purged once their retention period has passed.
+const deletedMessagePurgeInterval = 10 * time.Minute
+
+var (
+	// ErrInvalidMessage is returned when a message has no content or a malformed reply.
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrInvalidMessageEdit is returned when an edit has no content.
+	ErrInvalidMessageEdit = errors.New("invalid message edit")
+	// ErrSystemMessage is returned when editing or deleting a system message.
+	ErrSystemMessage = errors.New("system messages cannot be changed")
+	// ErrNotMessageAuthor is returned when someone other than its author edits a message.
+	ErrNotMessageAuthor = errors.New("only the author can edit this message")
+	// ErrEditWindowClosed is returned when a message is edited after the edit window.
+	ErrEditWindowClosed = errors.New("this message can no longer be edited")
+)
+
+// MessageEvent is sent to connected clients when a message changes.
+type MessageEvent struct {
+	ActorID string          `json:"actor_id"`
+	Message MessageResponse `json:"message"`
+}
+
+// SendMessageInput represents a message to send. ReplyToID quotes a message
+// and places the reply in its thread; ThreadRootID alone posts to a thread
+// without quoting. ClientMsgID is an optional ID chosen by the sender to
+// recognise the message when it is sent again.
+type SendMessageInput struct {
+	Content      string
+	ReplyToID    string
+	ThreadRootID string
+	ClientMsgID  string
+}
+
+// ThreadResponse represents a page of the replies in a thread, below its root message.
+type ThreadResponse struct {
+	Root MessageResponse `json:"root"`
+	GetChatMessagesResponse
+}
+
+// MessageRevisionResponse is the content a message had before an edit, and when it was written.
+type MessageRevisionResponse struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageHistoryResponse represents a message with its earlier revisions, oldest first.
+type MessageHistoryResponse struct {
+	Message   MessageResponse           `json:"message"`
+	Revisions []MessageRevisionResponse `json:"revisions"`
+	Count     int                       `json:"count"`
+}
+
+// SendMessage posts a message from the caller to the chat and sends it to
+// connected clients. If the caller has already sent a message with the same
+// ClientMsgID, that message is returned with db.ErrDuplicateMessage and
+// nothing is sent.
+func SendMessage(access *ChatAccess, input SendMessageInput) (MessageResponse, error) {
+	if err := requireVerifiedEmail(access.User); err != nil {
+		return MessageResponse{}, err
+	}
+	content := strings.TrimSpace(input.Content)
+	if content == "" {
+		return MessageResponse{}, fmt.Errorf("%w: content must not be empty", ErrInvalidMessage)
+	}
+	replyToID, err := parseMessageRef("reply_to_id", input.ReplyToID)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	threadRootID, err := parseMessageRef("thread_root_id", input.ThreadRootID)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	if len(input.ClientMsgID) > db.MaxClientMsgIDLength {
+		return MessageResponse{}, fmt.Errorf("%w: client_msg_id must be at most %d bytes", ErrInvalidMessage, db.MaxClientMsgIDLength)
+	}
+
+	chatID, _ := strconv.ParseInt(access.ChatID, 10, 64)
+	userID, _ := strconv.ParseInt(access.User.ID, 10, 64)
+	msg := &db.Message{
+		ChatID:       chatID,
+		UserID:       userID,
+		Username:     access.User.Username,
+		Kind:         db.MessageKindUser,
+		Content:      content,
+		ReplyToID:    replyToID,
+		ThreadRootID: threadRootID,
+		ClientMsgID:  sql.NullString{String: input.ClientMsgID, Valid: input.ClientMsgID != ""},
+	}
+	if err := db.InsertMessage(msg); errors.Is(err, db.ErrDuplicateMessage) {
+		return messageResponse(msg), err
+	} else if err != nil {
+		return MessageResponse{}, err
+	}
+	response := messageResponse(msg)
+	notifier.BroadcastToChat(msg.ChatID, EventMessageCreated, MessageEvent{ActorID: access.User.ID, Message: response})
+	return response, nil
+}
+
+// GetThread retrieves a page of the replies to a thread root message, oldest
+// first. Without a cursor or time it returns the latest replies.
+func GetThread(access *ChatAccess, messageID string, query MessageQuery) (ThreadResponse, error) {
+	root, err := db.GetMessage(access.ChatID, access.User.ID, messageID)
+	if err != nil {
+		return ThreadResponse{}, err
+	}
+	if root.ThreadRootID.Valid {
+		return ThreadResponse{}, fmt.Errorf("%w: message %d is a reply in thread %d", ErrInvalidMessageQuery, root.ID, root.ThreadRootID.Int64)
+	}
+	filter := db.MessageFilter{ChatID: access.ChatID, UserID: access.User.ID, ThreadRootID: root.ID}
+	page, err := getMessagePage(filter, query)
+	if err != nil {
+		return ThreadResponse{}, err
+	}
+	rootResponse, err := messageWithReactions(root, access.User.ID)
+	if err != nil {
+		return ThreadResponse{}, err
+	}
+	return ThreadResponse{Root: rootResponse, GetChatMessagesResponse: page}, nil
+}
+
+// EditMessage replaces the content of one of the caller's messages. Messages
+// can be edited within config.C.MessageEditWindow of being sent, while the
+// chat is not archived. The previous content is kept as a revision.
+func EditMessage(access *ChatAccess, messageID, content string) (MessageResponse, error) {
+	if err := requireVerifiedEmail(access.User); err != nil {
+		return MessageResponse{}, err
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return MessageResponse{}, fmt.Errorf("%w: content must not be empty", ErrInvalidMessageEdit)
+	}
+
+	msg, err := db.GetMessage(access.ChatID, access.User.ID, messageID)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	if err := checkMessageChange(access, msg); err != nil {
+		return MessageResponse{}, err
+	}
+	if strconv.FormatInt(msg.UserID, 10) != access.User.ID {
+		return MessageResponse{}, ErrNotMessageAuthor
+	}
+	if window := config.C.MessageEditWindow; window > 0 && time.Since(msg.CreatedAt) > window {
+		return MessageResponse{}, ErrEditWindowClosed
+	}
+	if content == msg.Content {
+		return messageResponse(msg), nil
+	}
+
+	if err := db.EditMessage(msg, content); err != nil {
+		return MessageResponse{}, err
+	}
+	response := messageResponse(msg)
+	notifier.BroadcastToChat(msg.ChatID, EventMessageEdited, MessageEvent{ActorID: access.User.ID, Message: response})
+	return response, nil
+}
+
+// DeleteMessage deletes a message for everyone in the chat, leaving a
+// tombstone in its place. Authors can delete their own messages; owners and
+// admins can delete any user's message. The content is purged after
+// config.C.DeletedMessageRetention.
+func DeleteMessage(access *ChatAccess, messageID string) (MessageResponse, error) {
+	msg, err := db.GetMessage(access.ChatID, access.User.ID, messageID)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	if err := checkMessageChange(access, msg); err != nil {
+		return MessageResponse{}, err
+	}
+	if strconv.FormatInt(msg.UserID, 10) != access.User.ID && !canManageMembers(access.Member.Role) {
+		return MessageResponse{}, ErrChatPermissionDenied
+	}
+
+	userID, _ := strconv.ParseInt(access.User.ID, 10, 64)
+	if err := db.DeleteMessage(msg, userID, config.C.DeletedMessageRetention == 0); err != nil {
+		return MessageResponse{}, err
+	}
+	response := messageResponse(msg)
+	notifier.BroadcastToChat(msg.ChatID, EventMessageDeleted, MessageEvent{ActorID: access.User.ID, Message: response})
+	return response, nil
+}
+
+// HideMessage hides a message of the chat from the caller only. Other members
+// still see it.
+func HideMessage(access *ChatAccess, messageID string) error {
+	msg, err := db.GetMessage(access.ChatID, access.User.ID, messageID)
+	if err != nil {
+		return err
+	}
+	return db.HideMessage(access.ChatID, access.User.ID, msg.ID)
+}
+
+// UnhideMessage shows a message the caller had hidden again.
+func UnhideMessage(access *ChatAccess, messageID string) error {
+	return db.UnhideMessage(access.ChatID, access.User.ID, messageID)
+}
+
+// GetMessageHistory returns a message of the chat with its earlier revisions.
+func GetMessageHistory(access *ChatAccess, messageID string) (MessageHistoryResponse, error) {
+	msg, err := db.GetMessage(access.ChatID, access.User.ID, messageID)
+	if err != nil {
+		return MessageHistoryResponse{}, err
+	}
+	revisions, err := db.GetMessageRevisions(msg.ID)
+	if err != nil {
+		return MessageHistoryResponse{}, err
+	}
+
+	response := MessageHistoryResponse{Message: messageResponse(msg), Revisions: []MessageRevisionResponse{}}
+	for _, rev := range revisions {
+		response.Revisions = append(response.Revisions, MessageRevisionResponse{
+			ID:        strconv.FormatInt(rev.ID, 10),
+			Content:   rev.Content,
+			CreatedAt: rev.CreatedAt,
+		})
+	}
+	response.Count = len(response.Revisions)
+	return response, nil
+}
+
+// RunDeletedMessagePurge periodically purges the content of messages deleted
+// more than config.C.DeletedMessageRetention ago, until the process exits. It
+// returns at once if deleted messages are purged as soon as they are deleted.
+func RunDeletedMessagePurge() {
+	if config.C.DeletedMessageRetention == 0 {
+		return
+	}
+	ticker := time.NewTicker(deletedMessagePurgeInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		n, err := db.PurgeDeletedMessages(time.Now().Add(-config.C.DeletedMessageRetention))
+		if err != nil {
+			log.Printf("RunDeletedMessagePurge: %v", err)
+		} else if n > 0 {
+			log.Printf("RunDeletedMessagePurge: purged %d deleted messages", n)
+		}
+	}
+}
+
+// parseMessageRef parses an optional message ID given in the named field.
+func parseMessageRef(field, id string) (sql.NullInt64, error) {
+	if id == "" {
+		return sql.NullInt64{}, nil
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 {
+		return sql.NullInt64{}, fmt.Errorf("%w: %s must be a message ID", ErrInvalidMessage, field)
+	}
+	return sql.NullInt64{Int64: n, Valid: true}, nil
+}
+
+// checkMessageChange returns an error if the message cannot be edited or deleted:
+// system messages, deleted messages and messages in archived chats.
+func checkMessageChange(access *ChatAccess, msg *db.Message) error {
+	if msg.Kind != db.MessageKindUser {
+		return ErrSystemMessage
+	}
+	if msg.DeletedAt.Valid {
+		return db.ErrMessageDeleted
+	}
+	chat, err := db.GetChatByID(access.ChatID)
+	if err != nil {
+		return err
+	}
+	if chat.ArchivedAt.Valid {
+		return db.ErrChatArchived
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// Page sizes of chat history.
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+)
+
+// messageCursorPrefix marks the decoded form of a message cursor.
+const messageCursorPrefix = "msg:"
+
+// ErrInvalidMessageQuery is returned when chat history is requested with an
+// invalid cursor, limit or combination of parameters.
+var ErrInvalidMessageQuery = errors.New("invalid message query")
+
+// MessageQuery selects a page of chat history. At most one of Before, After,
+// Around and At may be set; without any the latest messages are returned.
+type MessageQuery struct {
+	// Before, After and Around are cursors from a previous response.
+	Before string
+	After  string
+	Around string
+	// At jumps to the first message sent at or after the given time.
+	At *time.Time
+	// Limit is the page size; zero selects the default.
+	Limit int
+	// FoldThreads leaves thread replies out of the chat history; their root
+	// messages carry the reply count instead. It has no effect on a thread.
+	FoldThreads bool
+}
+
+// messagePage is a page of messages, oldest first.
+type messagePage struct {
+	messages []*db.Message
+	hasOlder bool
+	hasNewer bool
+}
+
+// loadMessagePage fetches the page of the filtered messages selected by the query.
+func loadMessagePage(filter db.MessageFilter, query MessageQuery, limit int) (messagePage, error) {
+	set := 0
+	for _, cursor := range []string{query.Before, query.After, query.Around} {
+		if cursor != "" {
+			set++
+		}
+	}
+	if query.At != nil {
+		set++
+	}
+	if set > 1 {
+		return messagePage{}, fmt.Errorf("%w: use only one of before, after, around and at", ErrInvalidMessageQuery)
+	}
+
+	switch {
+	case query.Before != "":
+		beforeID, err := decodeMessageCursor(query.Before)
+		if err != nil {
+			return messagePage{}, err
+		}
+		return messagesBefore(filter, beforeID, limit)
+	case query.After != "":
+		afterID, err := decodeMessageCursor(query.After)
+		if err != nil {
+			return messagePage{}, err
+		}
+		return messagesAfter(filter, afterID, limit)
+	case query.Around != "":
+		aroundID, err := decodeMessageCursor(query.Around)
+		if err != nil {
+			return messagePage{}, err
+		}
+		return messagesAround(filter, aroundID, limit)
+	case query.At != nil:
+		atID, err := db.GetMessageIDAt(filter, *query.At)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Nothing was sent since then; show the latest messages.
+			return messagesBefore(filter, math.MaxInt64, limit)
+		}
+		if err != nil {
+			return messagePage{}, fmt.Errorf("failed to look up message: %w", err)
+		}
+		return messagesAround(filter, atID, limit)
+	default:
+		return messagesBefore(filter, math.MaxInt64, limit)
+	}
+}
+
+func messagesBefore(filter db.MessageFilter, beforeID int64, limit int) (messagePage, error) {
+	messages, hasOlder, err := db.GetMessagesBefore(filter, beforeID, limit)
+	if err != nil || len(messages) == 0 {
+		return messagePage{messages: messages, hasOlder: hasOlder}, err
+	}
+	hasNewer, err := db.HasMessagesAfter(filter, messages[len(messages)-1].ID)
+	return messagePage{messages: messages, hasOlder: hasOlder, hasNewer: hasNewer}, err
+}
+
+func messagesAfter(filter db.MessageFilter, afterID int64, limit int) (messagePage, error) {
+	messages, hasNewer, err := db.GetMessagesAfter(filter, afterID, limit)
+	if err != nil || len(messages) == 0 {
+		return messagePage{messages: messages, hasNewer: hasNewer}, err
+	}
+	hasOlder, err := db.HasMessagesBefore(filter, messages[0].ID)
+	return messagePage{messages: messages, hasOlder: hasOlder, hasNewer: hasNewer}, err
+}
+
+// messagesAround returns the message with the given ID, if it still exists, in
+// the middle of a page of its neighbours.
+func messagesAround(filter db.MessageFilter, id int64, limit int) (messagePage, error) {
+	older, hasOlder, err := db.GetMessagesBefore(filter, id, limit/2)
+	if err != nil {
+		return messagePage{}, err
+	}
+	newer, hasNewer, err := db.GetMessagesAfter(filter, id-1, limit-len(older))
+	if err != nil {
+		return messagePage{}, err
+	}
+	return messagePage{messages: append(older, newer...), hasOlder: hasOlder, hasNewer: hasNewer}, nil
+}
+
+// encodeMessageCursor returns the opaque cursor pointing at a message.
+func encodeMessageCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(messageCursorPrefix + strconv.FormatInt(id, 10)))
+}
+
+func decodeMessageCursor(cursor string) (int64, error) {
+	invalid := fmt.Errorf("%w: malformed cursor", ErrInvalidMessageQuery)
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), messageCursorPrefix) {
+		return 0, invalid
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(string(raw), messageCursorPrefix), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, invalid
+	}
+	return id, nil
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"unicode"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// Event types sent to connected clients when reactions change.
+const (
+	EventReactionAdded   = "reaction.added"
+	EventReactionRemoved = "reaction.removed"
+)
+
+// maxReactionLength limits the length of a reaction in bytes, enough for emoji
+// sequences joined with zero-width joiners.
+const maxReactionLength = 32
+
+// ErrInvalidReaction is returned when a reaction is not an emoji.
+var ErrInvalidReaction = errors.New("reaction must be an emoji")
+
+// ReactionResponse counts the reactions to a message with one emoji. Reacted
+// reports whether the caller is among them.
+type ReactionResponse struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// ReactionEvent is sent to connected clients when a user adds or removes a
+// reaction. Count is the number of reactions with the emoji afterwards.
+type ReactionEvent struct {
+	UserID    string `json:"user_id"`
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"`
+}
+
+// AddReaction adds the caller's reaction to a message of the chat, and returns
+// the message with its reactions. Adding a reaction twice has no effect.
+func AddReaction(access *ChatAccess, messageID, emoji string) (MessageResponse, error) {
+	msg, err := reactionTarget(access, messageID, emoji)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	added, err := db.AddReaction(msg.ChatID, msg.ID, access.User.ID, emoji)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	if added {
+		notifyReaction(access, msg, EventReactionAdded, emoji)
+	}
+	return messageWithReactions(msg, access.User.ID)
+}
+
+// RemoveReaction removes the caller's reaction to a message of the chat, and
+// returns the message with its remaining reactions.
+func RemoveReaction(access *ChatAccess, messageID, emoji string) (MessageResponse, error) {
+	msg, err := reactionTarget(access, messageID, emoji)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	if err := db.RemoveReaction(msg.ID, access.User.ID, emoji); err != nil {
+		return MessageResponse{}, err
+	}
+	notifyReaction(access, msg, EventReactionRemoved, emoji)
+	return messageWithReactions(msg, access.User.ID)
+}
+
+// reactionTarget returns the message the caller reacts to, if reactions to it
+// can change: it must not be deleted, and the chat must not be archived.
+func reactionTarget(access *ChatAccess, messageID, emoji string) (*db.Message, error) {
+	if err := requireVerifiedEmail(access.User); err != nil {
+		return nil, err
+	}
+	if !validReaction(emoji) {
+		return nil, ErrInvalidReaction
+	}
+	msg, err := db.GetMessage(access.ChatID, access.User.ID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt.Valid {
+		return nil, db.ErrMessageDeleted
+	}
+	chat, err := db.GetChatByID(access.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	if chat.ArchivedAt.Valid {
+		return nil, db.ErrChatArchived
+	}
+	return msg, nil
+}
+
+// notifyReaction tells the chat's connected clients that the caller added or removed a reaction.
+func notifyReaction(access *ChatAccess, msg *db.Message, eventType, emoji string) {
+	count, err := db.CountReactions(msg.ID, emoji)
+	if err != nil {
+		log.Printf("notifyReaction: failed to count reactions to message %d: %v", msg.ID, err)
+		return
+	}
+	notifier.BroadcastToChat(msg.ChatID, eventType, ReactionEvent{
+		UserID:    access.User.ID,
+		MessageID: strconv.FormatInt(msg.ID, 10),
+		Emoji:     emoji,
+		Count:     count,
+	})
+}
+
+// messageWithReactions converts a message to its response format with its reactions as seen by the user.
+func messageWithReactions(msg *db.Message, userID string) (MessageResponse, error) {
+	responses, err := messageResponses([]*db.Message{msg}, userID)
+	if err != nil {
+		return MessageResponse{}, err
+	}
+	return responses[0], nil
+}
+
+// messageResponses converts messages to their response format with their reactions as seen by the user.
+func messageResponses(messages []*db.Message, userID string) ([]MessageResponse, error) {
+	ids := make([]int64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	reactions, err := db.GetReactions(ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reactions: %w", err)
+	}
+
+	responses := make([]MessageResponse, len(messages))
+	for i, msg := range messages {
+		responses[i] = messageResponse(msg)
+		for _, reaction := range reactions[msg.ID] {
+			responses[i].Reactions = append(responses[i].Reactions, ReactionResponse{
+				Emoji:   reaction.Emoji,
+				Count:   reaction.Count,
+				Reacted: reaction.Reacted,
+			})
+		}
+	}
+	return responses, nil
+}
+
+// validReaction reports whether s looks like a single emoji: symbols combined
+// with modifiers, joiners and variation selectors, or a keycap sequence.
+func validReaction(s string) bool {
+	if s == "" || len(s) > maxReactionLength {
+		return false
+	}
+	symbol := false
+	for i, r := range s {
+		switch {
+		case unicode.Is(unicode.So, r):
+			symbol = true
+		case r == '\u20e3': // combining enclosing keycap
+			symbol = true
+		case unicode.Is(unicode.Sk, r), unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r), unicode.Is(unicode.Cf, r):
+		case i == 0 && (unicode.IsDigit(r) || r == '#' || r == '*'):
+		default:
+			return false
+		}
+	}
+	return symbol
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/app/oidc"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/google/uuid"
+)
+
+// oidcLoginTTL is how long the user has to complete the login at the identity provider.
+const oidcLoginTTL = 10 * time.Minute
+
+// ErrOIDCNotConfigured is returned when single sign-on is used without a configured provider.
+var ErrOIDCNotConfigured = errors.New("single sign-on is not configured")
+
+// ErrInvalidOIDCState is returned when the callback's state does not match a pending login.
+var ErrInvalidOIDCState = errors.New("invalid or expired single sign-on login")
+
+// ErrOIDCEmailNotVerified is returned when the identity provider does not vouch for the user's email.
+var ErrOIDCEmailNotVerified = errors.New("identity provider did not return a verified email address")
+
+// ErrOIDCAccountNotVerified is returned when the identity's email belongs to a
+// local user whose email was never verified. Linking it would let whoever
+// registered that account keep signing in with its password.
+var ErrOIDCAccountNotVerified = errors.New("an account with this email exists but its email is not verified; verify it before using single sign-on")
+
+// oidcProvider is the identity provider used for single sign-on, if configured.
+var oidcProvider *oidc.Provider
+
+// SetOIDCProvider registers the identity provider used for single sign-on.
+func SetOIDCProvider(p *oidc.Provider) {
+	oidcProvider = p
+}
+
+// StartOIDCLogin begins a single sign-on login and returns the identity
+// provider URL to redirect the user to.
+func StartOIDCLogin(ctx context.Context) (string, error) {
+	if oidcProvider == nil {
+		return "", ErrOIDCNotConfigured
+	}
+
+	state, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := oidcProvider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+	pending := db.OIDCLoginState{Nonce: nonce, CodeVerifier: verifier}
+	if err := db.InsertOIDCLoginState(auth.HashToken(state), pending, time.Now().Add(oidcLoginTTL)); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// CompleteOIDCLogin handles the identity provider callback. It redeems the
+// authorization code, finds, links or creates the local user, and starts a
+// new session the same way LoginUser does. Users with two-factor
+// authentication enabled get a challenge instead, unless the provider asserts
+// a second factor trusted by config.C.OIDCMFAValues.
+func CompleteOIDCLogin(ctx context.Context, state, code string, client ClientInfo) (LoginResponse, error) {
+	if oidcProvider == nil {
+		return LoginResponse{}, ErrOIDCNotConfigured
+	}
+
+	pending, err := db.ConsumeOIDCLoginState(auth.HashToken(state))
+	if err != nil {
+		if errors.Is(err, db.ErrOIDCStateInvalid) {
+			return LoginResponse{}, ErrInvalidOIDCState
+		}
+		return LoginResponse{}, err
+	}
+
+	rawIDToken, err := oidcProvider.Exchange(ctx, code, pending.CodeVerifier)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	claims, err := oidcProvider.VerifyIDToken(ctx, rawIDToken, pending.Nonce)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	user, err := resolveOIDCUser(oidcProvider.Issuer(), claims)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	if user.TOTPEnabled && !oidcAssertsMFA(claims) {
+		challenge, err := issueMFAChallenge(user)
+		if err != nil {
+			return LoginResponse{}, err
+		}
+		return LoginResponse{MFARequired: true, ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := issueTokens(user, uuid.New().String(), client)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return LoginResponse{TokenResponse: &tokens}, nil
+}
+
+// oidcAssertsMFA reports whether the ID token carries an amr or acr value
+// that config.C.OIDCMFAValues trusts as a second factor.
+func oidcAssertsMFA(claims *oidc.Claims) bool {
+	for _, trusted := range strings.Fields(config.C.OIDCMFAValues) {
+		if claims.AuthContext == trusted {
+			return true
+		}
+		for _, method := range claims.AuthMethods {
+			if method == trusted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveOIDCUser returns the user linked to the identity. An unlinked
+// identity is linked to the user with the same email if both the provider and
+// the user have verified it, or a new user is created for it.
+func resolveOIDCUser(issuer string, claims *oidc.Claims) (*db.User, error) {
+	user, err := db.GetUserByIdentity(issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err = db.GetUserByEmail(claims.Email)
+	if err == nil {
+		if !user.EmailVerified {
+			return nil, ErrOIDCAccountNotVerified
+		}
+		if err := db.LinkUserIdentity(user.ID, issuer, claims.Subject, claims.Email); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	username, err := availableUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+	return db.InsertIdentityUser(username, claims.Email, issuer, claims.Subject)
+}
+
+// availableUsername derives an unused username from the identity's preferred
+// username or email address.
+func availableUsername(claims *oidc.Claims) (string, error) {
+	base := sanitizeUsername(claims.PreferredUsername)
+	if base == "" {
+		base = sanitizeUsername(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		_, err := db.GetUserByUsername(candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return base + "-" + uuid.New().String()[:8], nil
+}
+
+// sanitizeUsername keeps the letters, digits, dots, dashes and underscores of name.
+func sanitizeUsername(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,446 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/app/oidc"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/1akhilpandey/go-messaging/db/dbtest"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const mockClientID = "go-messaging-test"
+
+// mockProvider is an in-process OpenID Connect provider. It serves discovery,
+// its key set and a token endpoint that checks the PKCE code verifier.
+type mockProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+	// pkceFailures counts token requests whose code verifier did not match.
+	pkceFailures int
+}
+
+// mockGrant is an authorization code waiting to be redeemed.
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	p := &mockProvider{key: key, grants: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.serveToken)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *mockProvider) serveToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	pkceOK := ok && base64.RawURLEncoding.EncodeToString(verifier[:]) == grant.challenge
+	if ok && !pkceOK {
+		p.pkceFailures++
+	}
+	p.mu.Unlock()
+	if !pkceOK {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+}
+
+// authorize plays the user signing in at the provider: it reads the request
+// from authURL and returns the state and a code for an ID token with the given
+// claims. Standard claims not given are filled in from the request.
+func (p *mockProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth URL %q: %v", authURL, err)
+	}
+	params := u.Query()
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		t.Fatalf("auth URL %q has no S256 code challenge", authURL)
+	}
+
+	now := time.Now()
+	full := jwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   params.Get("client_id"),
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": params.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code, err = auth.GenerateOpaqueToken(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.grants[code] = mockGrant{challenge: params.Get("code_challenge"), claims: full}
+	p.mu.Unlock()
+	return params.Get("state"), code
+}
+
+// setupOIDC prepares a database and signing keys, and registers a mock provider for single sign-on.
+func setupOIDC(t *testing.T) *mockProvider {
+	t.Helper()
+	dbtest.Setup(t)
+	if _, err := auth.InitKeys("", "test-secret"); err != nil {
+		t.Fatalf("failed to set up keys: %v", err)
+	}
+	p := newMockProvider(t)
+	SetOIDCProvider(oidc.NewProvider(oidc.Config{
+		Issuer:      p.URL,
+		ClientID:    mockClientID,
+		RedirectURL: "http://localhost:8080/user/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}))
+	t.Cleanup(func() { SetOIDCProvider(nil) })
+	return p
+}
+
+// startLogin begins a login and has the provider authorize it with the given claims.
+func startLogin(t *testing.T, p *mockProvider, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+	authURL, err := StartOIDCLogin(context.Background())
+	if err != nil {
+		t.Fatalf("StartOIDCLogin: %v", err)
+	}
+	return p.authorize(t, authURL, claims)
+}
+
+// completeLogin runs a whole login with the given claims.
+func completeLogin(t *testing.T, p *mockProvider, claims jwt.MapClaims) (LoginResponse, error) {
+	t.Helper()
+	state, code := startLogin(t, p, claims)
+	return CompleteOIDCLogin(context.Background(), state, code, ClientInfo{DeviceName: "test"})
+}
+
+func verifiedIdentity(subject, email string) jwt.MapClaims {
+	return jwt.MapClaims{"sub": subject, "email": email, "email_verified": true}
+}
+
+// markEmailVerified verifies the user's email as following the emailed link does.
+func markEmailVerified(t *testing.T, userID string) {
+	t.Helper()
+	if err := db.InsertEmailVerificationToken(userID, "verify-"+userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.VerifyEmail("verify-" + userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	p := setupOIDC(t)
+
+	claims := verifiedIdentity("sub-new", "new@example.com")
+	claims["preferred_username"] = "new user!"
+	resp, err := completeLogin(t, p, claims)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if resp.MFARequired || resp.TokenResponse == nil || resp.AccessToken == "" {
+		t.Fatalf("first login did not issue tokens: %+v", resp)
+	}
+
+	user, err := db.GetUserByIdentity(p.URL, "sub-new")
+	if err != nil {
+		t.Fatalf("identity was not linked: %v", err)
+	}
+	if user.Username != "newuser" || user.Email != "new@example.com" || !user.EmailVerified {
+		t.Errorf("provisioned user = %+v", user)
+	}
+
+	// Later logins find the same user by identity, even if the email changed.
+	if _, err := completeLogin(t, p, verifiedIdentity("sub-new", "renamed@example.com")); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	again, err := db.GetUserByIdentity(p.URL, "sub-new")
+	if err != nil || again.ID != user.ID {
+		t.Errorf("second login resolved to %+v (%v), want user %s", again, err, user.ID)
+	}
+}
+
+func TestOIDCLoginProvisionsUniqueUsername(t *testing.T) {
+	p := setupOIDC(t)
+	if _, err := db.InsertUser("taken", "taken@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := verifiedIdentity("sub-taken", "someone@example.com")
+	claims["preferred_username"] = "taken"
+	if _, err := completeLogin(t, p, claims); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	user, err := db.GetUserByIdentity(p.URL, "sub-taken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "taken2" {
+		t.Errorf("username = %q, want taken2", user.Username)
+	}
+}
+
+func TestOIDCLoginLinksExistingUser(t *testing.T) {
+	p := setupOIDC(t)
+	existing, err := db.InsertUser("alice", "alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	markEmailVerified(t, existing.ID)
+
+	if _, err := completeLogin(t, p, verifiedIdentity("sub-alice", "alice@example.com")); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	user, err := db.GetUserByIdentity(p.URL, "sub-alice")
+	if err != nil {
+		t.Fatalf("identity was not linked: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("identity linked to user %s, want %s", user.ID, existing.ID)
+	}
+}
+
+func TestOIDCLoginDoesNotLinkUnverifiedUser(t *testing.T) {
+	p := setupOIDC(t)
+	if _, err := db.InsertUser("mallory", "victim@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := completeLogin(t, p, verifiedIdentity("sub-victim", "victim@example.com"))
+	if !errors.Is(err, ErrOIDCAccountNotVerified) {
+		t.Fatalf("err = %v, want ErrOIDCAccountNotVerified", err)
+	}
+	if _, err := db.GetUserByIdentity(p.URL, "sub-victim"); err == nil {
+		t.Error("identity was linked to an unverified user")
+	}
+}
+
+func TestOIDCLoginRequiresVerifiedEmail(t *testing.T) {
+	p := setupOIDC(t)
+	if _, err := db.InsertUser("bob", "bob@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.MapClaims{"sub": "sub-bob", "email": "bob@example.com", "email_verified": false}
+	if _, err := completeLogin(t, p, claims); !errors.Is(err, ErrOIDCEmailNotVerified) {
+		t.Fatalf("err = %v, want ErrOIDCEmailNotVerified", err)
+	}
+	if _, err := db.GetUserByIdentity(p.URL, "sub-bob"); err == nil {
+		t.Error("unverified identity was linked")
+	}
+}
+
+func TestOIDCLoginPKCE(t *testing.T) {
+	p := setupOIDC(t)
+
+	// The verifier stored with the state matches the challenge sent to the provider.
+	if _, err := completeLogin(t, p, verifiedIdentity("sub-pkce", "pkce@example.com")); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if p.pkceFailures != 0 {
+		t.Fatalf("provider rejected %d code verifiers", p.pkceFailures)
+	}
+
+	// A code redeemed with any other verifier is refused.
+	state, code := startLogin(t, p, verifiedIdentity("sub-pkce", "pkce@example.com"))
+	if _, err := db.DB.Exec("UPDATE oidc_login_states SET code_verifier = 'wrong' WHERE state_hash = ?", auth.HashToken(state)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompleteOIDCLogin(context.Background(), state, code, ClientInfo{}); err == nil {
+		t.Fatal("login succeeded with the wrong code verifier")
+	}
+	if p.pkceFailures != 1 {
+		t.Errorf("provider saw %d verifier mismatches, want 1", p.pkceFailures)
+	}
+}
+
+func TestOIDCLoginNonceMismatch(t *testing.T) {
+	p := setupOIDC(t)
+
+	claims := verifiedIdentity("sub-nonce", "nonce@example.com")
+	claims["nonce"] = "replayed-nonce"
+	if _, err := completeLogin(t, p, claims); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+	if _, err := db.GetUserByIdentity(p.URL, "sub-nonce"); err == nil {
+		t.Error("user was provisioned from a token with the wrong nonce")
+	}
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	p := setupOIDC(t)
+	ctx := context.Background()
+
+	t.Run("reused", func(t *testing.T) {
+		state, code := startLogin(t, p, verifiedIdentity("sub-state", "state@example.com"))
+		if _, err := CompleteOIDCLogin(ctx, state, code, ClientInfo{}); err != nil {
+			t.Fatalf("first use: %v", err)
+		}
+		if _, err := CompleteOIDCLogin(ctx, state, code, ClientInfo{}); !errors.Is(err, ErrInvalidOIDCState) {
+			t.Fatalf("second use: err = %v, want ErrInvalidOIDCState", err)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, code := startLogin(t, p, verifiedIdentity("sub-state", "state@example.com"))
+		if _, err := CompleteOIDCLogin(ctx, "forged-state", code, ClientInfo{}); !errors.Is(err, ErrInvalidOIDCState) {
+			t.Fatalf("err = %v, want ErrInvalidOIDCState", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		state, code := startLogin(t, p, verifiedIdentity("sub-state", "state@example.com"))
+		expired := time.Now().Add(-time.Minute).UTC()
+		if _, err := db.DB.Exec("UPDATE oidc_login_states SET expires_at = ? WHERE state_hash = ?", expired, auth.HashToken(state)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CompleteOIDCLogin(ctx, state, code, ClientInfo{}); !errors.Is(err, ErrInvalidOIDCState) {
+			t.Fatalf("err = %v, want ErrInvalidOIDCState", err)
+		}
+	})
+
+	t.Run("expired states are cleaned up", func(t *testing.T) {
+		state, _ := startLogin(t, p, verifiedIdentity("sub-state", "state@example.com"))
+		expired := time.Now().Add(-time.Minute).UTC()
+		if _, err := db.DB.Exec("UPDATE oidc_login_states SET expires_at = ? WHERE state_hash = ?", expired, auth.HashToken(state)); err != nil {
+			t.Fatal(err)
+		}
+		fresh, _ := startLogin(t, p, verifiedIdentity("sub-state", "state@example.com"))
+
+		var n int
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM oidc_login_states WHERE state_hash = ?", auth.HashToken(state)).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Error("expired login state was not deleted")
+		}
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM oidc_login_states WHERE state_hash = ?", auth.HashToken(fresh)).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Error("pending login state was deleted")
+		}
+	})
+}
+
+func TestOIDCLoginTwoFactor(t *testing.T) {
+	p := setupOIDC(t)
+	user, err := db.InsertUser("carol", "carol@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	markEmailVerified(t, user.ID)
+	if _, err := db.DB.Exec("UPDATE users SET totp_enabled = 1 WHERE id = ?", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	defer func(values string) { config.C.OIDCMFAValues = values }(config.C.OIDCMFAValues)
+
+	tests := []struct {
+		name      string
+		mfaValues string
+		amr       []string
+		acr       string
+		wantMFA   bool
+	}{
+		{name: "no assertion", mfaValues: "mfa", wantMFA: true},
+		{name: "assertion not trusted", amr: []string{"pwd", "mfa"}, wantMFA: true},
+		{name: "other method", mfaValues: "mfa", amr: []string{"pwd"}, wantMFA: true},
+		{name: "trusted amr", mfaValues: "mfa otp", amr: []string{"pwd", "otp"}, wantMFA: false},
+		{name: "trusted acr", mfaValues: "urn:example:mfa", acr: "urn:example:mfa", wantMFA: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.C.OIDCMFAValues = tt.mfaValues
+			claims := verifiedIdentity("sub-carol", "carol@example.com")
+			if tt.amr != nil {
+				claims["amr"] = tt.amr
+			}
+			if tt.acr != "" {
+				claims["acr"] = tt.acr
+			}
+
+			resp, err := completeLogin(t, p, claims)
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			if tt.wantMFA {
+				if !resp.MFARequired || resp.ChallengeToken == "" || resp.TokenResponse != nil {
+					t.Fatalf("response = %+v, want a two-factor challenge", resp)
+				}
+				if challenged, err := parseMFAChallenge(resp.ChallengeToken); err != nil || challenged.User.ID != user.ID {
+					t.Errorf("challenge is for %+v (%v), want user %s", challenged, err, user.ID)
+				}
+			} else if resp.MFARequired || resp.TokenResponse == nil {
+				t.Fatalf("response = %+v, want tokens", resp)
+			}
+		})
+	}
+}
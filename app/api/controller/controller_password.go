@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/app/mail"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// minPasswordLength is the minimum length accepted for a new password.
+const minPasswordLength = 8
+
+// ErrInvalidResetToken is returned when a password reset token cannot be used.
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// ErrPasswordTooShort is returned when a new password is shorter than minPasswordLength.
+var ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+
+// ForgotPassword emails a single-use password reset link to the account with the given email.
+// It reports success even when no account exists so callers cannot probe for registered emails.
+// The link is created and sent in the background, so the response takes as long either way.
+func ForgotPassword(email string) error {
+	user, err := db.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+	go func() {
+		// Failures are only logged: reporting them would confirm the account exists.
+		if err := sendPasswordReset(user); err != nil {
+			log.Printf("ForgotPassword: failed to send reset email to user %s: %v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// sendPasswordReset stores a new reset token for the user and emails them the link.
+func sendPasswordReset(user *db.User) error {
+	token, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(config.C.PasswordResetTTL)
+	if err := db.InsertPasswordResetToken(user.ID, auth.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.C.AppBaseURL, token)
+	return mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\n"+
+			"If you did not request a password reset, you can ignore this email.\n",
+			user.Username, config.C.PasswordResetTTL, link),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out of every session.
+func ResetPassword(token, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+
+	userID, err := db.ResetPassword(auth.HashToken(token), newPassword)
+	if errors.Is(err, db.ErrResetTokenInvalid) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	disconnectUser(userID)
+	return nil
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/mail"
+	"github.com/1akhilpandey/go-messaging/db/dbtest"
+)
+
+// blockingMailer hands each message to sent and blocks until release is closed,
+// like a slow SMTP server.
+type blockingMailer struct {
+	sent    chan mail.Message
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(msg mail.Message) error {
+	m.sent <- msg
+	<-m.release
+	return nil
+}
+
+func TestForgotPasswordDoesNotWaitForMail(t *testing.T) {
+	dbtest.Setup(t)
+	user := insertUser(t, "erin")
+	m := &blockingMailer{sent: make(chan mail.Message, 1), release: make(chan struct{})}
+	defer func(previous mail.Mailer) { mailer = previous }(mailer)
+	mailer = m
+
+	done := make(chan error, 1)
+	go func() { done <- ForgotPassword(user.Email) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ForgotPassword: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ForgotPassword waited for the mail to be delivered")
+	}
+
+	var msg mail.Message
+	select {
+	case msg = <-m.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset email was sent")
+	}
+	close(m.release)
+	if msg.To != user.Email {
+		t.Errorf("email sent to %q, want %q", msg.To, user.Email)
+	}
+
+	i := strings.Index(msg.Body, "token=")
+	if i < 0 {
+		t.Fatalf("email has no reset link: %q", msg.Body)
+	}
+	token := strings.Fields(msg.Body[i+len("token="):])[0]
+	if err := ResetPassword(token, "new-password"); err != nil {
+		t.Errorf("ResetPassword with the emailed token: %v", err)
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	dbtest.Setup(t)
+	m := &blockingMailer{sent: make(chan mail.Message, 1), release: make(chan struct{})}
+	close(m.release)
+	defer func(previous mail.Mailer) { mailer = previous }(mailer)
+	mailer = m
+
+	if err := ForgotPassword("nobody@example.com"); err != nil {
+		t.Fatalf("ForgotPassword: %v", err)
+	}
+	select {
+	case msg := <-m.sent:
+		t.Errorf("email sent for an unknown address: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
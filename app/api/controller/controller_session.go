@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// ClientInfo describes the device a session is started or refreshed from.
+type ClientInfo struct {
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+}
+
+// SessionResponse represents an active login session.
+type SessionResponse struct {
+	TokenID    string    `json:"token_id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// GetUserSessionsResponse represents the data returned when listing a user's sessions.
+type GetUserSessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+	Count    int               `json:"count"`
+}
+
+// GetUserSessions lists the user's active sessions, flagging the one identified by currentSessionID.
+func GetUserSessions(username, currentSessionID string) (GetUserSessionsResponse, error) {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return GetUserSessionsResponse{}, err
+	}
+
+	sessions, err := db.GetUserSessions(user.ID)
+	if err != nil {
+		return GetUserSessionsResponse{}, err
+	}
+
+	sessionResponses := []SessionResponse{}
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, SessionResponse{
+			TokenID:    session.TokenID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.FamilyID == currentSessionID,
+		})
+	}
+
+	return GetUserSessionsResponse{
+		Sessions: sessionResponses,
+		Count:    len(sessionResponses),
+	}, nil
+}
+
+// RevokeSession revokes the user's session that the given token ID belongs to
+// and closes the WebSocket connections opened with it.
+func RevokeSession(username, tokenID string) error {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	token, err := db.GetUserTokenByID(user.ID, tokenID)
+	if err != nil {
+		return err
+	}
+	if err := db.RevokeTokenFamily(token.FamilyID); err != nil {
+		return err
+	}
+	notifier.DisconnectSession(token.FamilyID)
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user except currentSessionID.
+func RevokeOtherSessions(username, currentSessionID string) error {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := db.RevokeOtherUserTokens(user.ID, currentSessionID)
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range revoked {
+		notifier.DisconnectSession(sessionID)
+	}
+	return nil
+}
+
+// disconnectUser closes every WebSocket connection belonging to the user.
+func disconnectUser(userID string) {
+	if id, err := strconv.ParseInt(userID, 10, 64); err == nil {
+		notifier.DisconnectUser(id)
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or revoked.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// TokenResponse represents the tokens returned after login or a token refresh.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// issueTokens creates a short-lived access JWT and an opaque refresh token for the user.
+// Both tokens belong to familyID, so revoking the family ends the session.
+func issueTokens(user *db.User, familyID string, client ClientInfo) (TokenResponse, error) {
+	now := time.Now()
+	accessExpiresAt := now.Add(config.C.AccessTokenTTL)
+
+	// The token ID is embedded as "jti" so every token is distinct and individually revocable.
+	accessID := uuid.New().String()
+	accessToken, err := auth.Keys.Sign(jwt.MapClaims{
+		"jti":      accessID,
+		"sub":      user.ID,
+		"username": user.Username,
+		"iat":      now.Unix(),
+		"exp":      accessExpiresAt.Unix(),
+	})
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	access := db.UserToken{
+		TokenID:    accessID,
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		Type:       db.TokenTypeAccess,
+		ExpiresAt:  accessExpiresAt,
+		DeviceName: client.DeviceName,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+	}
+	if err := db.InsertUserToken(access, accessToken); err != nil {
+		return TokenResponse{}, err
+	}
+
+	// Refresh tokens are opaque and only their hash is stored.
+	refreshToken, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	refresh := db.UserToken{
+		TokenID:    uuid.New().String(),
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		Type:       db.TokenTypeRefresh,
+		ExpiresAt:  now.Add(config.C.RefreshTokenTTL),
+		DeviceName: client.DeviceName,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+	}
+	if err := db.InsertUserToken(refresh, auth.HashToken(refreshToken)); err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(config.C.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token can be used once; reusing one revokes the whole session.
+// The session keeps its device name unless the client provides a new one.
+func RefreshTokens(refreshToken string, client ClientInfo) (TokenResponse, error) {
+	if refreshToken == "" {
+		return TokenResponse{}, ErrInvalidRefreshToken
+	}
+
+	consumed, err := db.ConsumeRefreshToken(auth.HashToken(refreshToken))
+	if errors.Is(err, db.ErrRefreshTokenReused) {
+		notifier.DisconnectSession(consumed.FamilyID)
+		return TokenResponse{}, ErrInvalidRefreshToken
+	}
+	if errors.Is(err, db.ErrTokenInactive) {
+		return TokenResponse{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	user, err := db.GetUserByID(consumed.UserID)
+	if err != nil {
+		return TokenResponse{}, ErrInvalidRefreshToken
+	}
+	if client.DeviceName == "" {
+		client.DeviceName = consumed.DeviceName
+	}
+	return issueTokens(user, consumed.FamilyID, client)
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/1akhilpandey/go-messaging/db/dbtest"
+)
+
+// sessionRecorder records the sessions whose connections were closed.
+type sessionRecorder struct {
+	noopNotifier
+	disconnected []string
+}
+
+func (r *sessionRecorder) DisconnectSession(sessionID string) {
+	r.disconnected = append(r.disconnected, sessionID)
+}
+
+// login signs the user in with their password and returns the token pair.
+func login(t *testing.T, user *db.User) TokenResponse {
+	t.Helper()
+	resp, err := LoginUser(user.Email, "password", ClientInfo{DeviceName: "test"})
+	if err != nil || resp.TokenResponse == nil {
+		t.Fatalf("LoginUser = %+v, %v", resp, err)
+	}
+	return *resp.TokenResponse
+}
+
+func setupTokens(t *testing.T) *db.User {
+	t.Helper()
+	dbtest.Setup(t)
+	if _, err := auth.InitKeys("", "test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	return insertUser(t, "frank")
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	user := setupTokens(t)
+	first := login(t, user)
+
+	second, err := RefreshTokens(first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("refresh did not issue new tokens")
+	}
+	if _, err := db.GetActiveUserToken(second.AccessToken); err != nil {
+		t.Errorf("new access token is not active: %v", err)
+	}
+	third, err := RefreshTokens(second.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens with the rotated token: %v", err)
+	}
+
+	sessions, err := GetUserSessions(user.Username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions.Count != 1 {
+		t.Errorf("user has %d sessions, want 1", sessions.Count)
+	}
+	if _, err := db.GetActiveUserToken(third.AccessToken); err != nil {
+		t.Errorf("latest access token is not active: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	user := setupTokens(t)
+	recorder := &sessionRecorder{}
+	defer func(previous Notifier) { notifier = previous }(notifier)
+	notifier = recorder
+
+	first := login(t, user)
+	other := login(t, user)
+	second, err := RefreshTokens(first.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	family, err := db.GetActiveUserToken(second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The consumed refresh token is presented again, e.g. by an attacker who copied it.
+	if _, err := RefreshTokens(first.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reused refresh token = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	for name, token := range map[string]string{"first": first.AccessToken, "second": second.AccessToken} {
+		if _, err := db.GetActiveUserToken(token); !errors.Is(err, db.ErrTokenInactive) {
+			t.Errorf("%s access token = %v, want ErrTokenInactive", name, err)
+		}
+	}
+	if _, err := RefreshTokens(second.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("latest refresh token = %v, want ErrInvalidRefreshToken", err)
+	}
+	if len(recorder.disconnected) != 1 || recorder.disconnected[0] != family.FamilyID {
+		t.Errorf("disconnected sessions %v, want [%s]", recorder.disconnected, family.FamilyID)
+	}
+
+	// Other sessions of the user are not affected.
+	if _, err := db.GetActiveUserToken(other.AccessToken); err != nil {
+		t.Errorf("other session's access token: %v", err)
+	}
+	if _, err := RefreshTokens(other.RefreshToken, ClientInfo{}); err != nil {
+		t.Errorf("other session's refresh token: %v", err)
+	}
+}
+
+func TestRefreshTokensUnknown(t *testing.T) {
+	setupTokens(t)
+	for _, token := range []string{"", "not-a-token"} {
+		if _, err := RefreshTokens(token, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("RefreshTokens(%q) = %v, want ErrInvalidRefreshToken", token, err)
+		}
+	}
+}
@@ -2,10 +2,11 @@ package controller
 
 import (
 	"errors"
-	"time"
+	"log"
+	netmail "net/mail"
 
+	"github.com/1akhilpandey/go-messaging/config"
 	"github.com/1akhilpandey/go-messaging/db"
-	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -19,26 +20,38 @@ type CreateUserInput struct {
 
 // UserResponse represents the data returned after creating or retrieving a user.
 type UserResponse struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
 // CreateUser processes the creation of a new user and interacts with the database.
+// The account starts unverified and a verification link is emailed to the user.
 func CreateUser(input CreateUserInput) (UserResponse, error) {
 	if input.Username == "" {
 		return UserResponse{}, errors.New("username is required")
 	}
+	if addr, err := netmail.ParseAddress(input.Email); err != nil || addr.Address != input.Email {
+		return UserResponse{}, errors.New("a valid email address is required")
+	}
 
 	newUser, err := db.InsertUser(input.Username, input.Email, input.Password)
 	if err != nil {
 		return UserResponse{}, err
 	}
 
+	allowVerificationEmail(newUser.Email)
+	if err := sendVerificationEmail(newUser); err != nil {
+		// The user can request another link, so signup still succeeds.
+		log.Printf("CreateUser: failed to send verification email to user %s: %v", newUser.ID, err)
+	}
+
 	return UserResponse{
-		ID:       newUser.ID,
-		Username: newUser.Username,
-		Email:    newUser.Email,
+		ID:            newUser.ID,
+		Username:      newUser.Username,
+		Email:         newUser.Email,
+		EmailVerified: newUser.EmailVerified,
 	}, nil
 }
 
@@ -50,46 +63,89 @@ func GetUser(id string) (UserResponse, error) {
 	}
 
 	return UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
 	}, nil
 }
 
-// LoginUser authenticates a user and returns a JWT token.
-func LoginUser(email, password string) (string, error) {
+// LoginResponse represents the result of a password login. When the user has
+// two-factor authentication enabled, it carries a challenge token to exchange
+// at CompleteTwoFactorLogin instead of session tokens.
+type LoginResponse struct {
+	*TokenResponse
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
+}
+
+// LoginUser authenticates a user and starts a new session, returning an
+// access token and a refresh token.
+func LoginUser(email, password string, client ClientInfo) (LoginResponse, error) {
+	keys := loginThrottleKeys(email, client.IPAddress)
+	if err := checkLoginLockout(keys); err != nil {
+		return LoginResponse{}, err
+	}
+
 	user, err := db.GetUserByEmail(email)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		// Spend the same time as a real password check so unknown emails are not revealed.
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		recordLoginFailure(keys)
+		return LoginResponse{}, errors.New("invalid credentials")
 	}
 
 	// Verify password using bcrypt (assumes user.Password is stored as a bcrypt hash)
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+		recordLoginFailure(keys)
+		return LoginResponse{}, errors.New("invalid credentials")
 	}
 
-	// Create JWT token with a 72-hour expiration
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":      user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(72 * time.Hour).Unix(),
-	})
+	if !user.EmailVerified && config.C.UnverifiedUserPolicy == config.UnverifiedDeny {
+		return LoginResponse{}, ErrEmailNotVerified
+	}
 
-	// Sign the token with a secret key (should be in configuration)
-	tokenString, err := token.SignedString([]byte("mysecret"))
-	if err != nil {
-		return "", err
+	if user.TOTPEnabled {
+		challenge, err := issueMFAChallenge(user)
+		if err != nil {
+			return LoginResponse{}, err
+		}
+		return LoginResponse{MFARequired: true, ChallengeToken: challenge}, nil
 	}
-	tokenID := uuid.New().String()
-	expiresAt := time.Now().Add(72 * time.Hour)
-	if err := db.InsertUserToken(tokenID, user.ID, tokenString, expiresAt); err != nil {
-		return "", err
+
+	tokens, err := issueTokens(user, uuid.New().String(), client)
+	if err != nil {
+		return LoginResponse{}, err
 	}
-	return tokenString, nil
+	clearLoginFailures(user.Email)
+	return LoginResponse{TokenResponse: &tokens}, nil
 }
 
 // LogoutUser handles user logout.
-// Revokes the provided token during security events such as logout.
+// Revokes the session the provided access token belongs to, including its refresh token,
+// and closes the WebSocket connections opened with it.
 func LogoutUser(token string) error {
-	return db.RevokeToken(token)
+	current, err := db.GetActiveUserToken(token)
+	if err != nil {
+		return err
+	}
+	if err := db.RevokeTokenFamily(current.FamilyID); err != nil {
+		return err
+	}
+	notifier.DisconnectSession(current.FamilyID)
+	return nil
+}
+
+// LogoutAllUser revokes every outstanding token issued to the user,
+// signing them out of all sessions.
+func LogoutAllUser(username string) error {
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if err := db.RevokeUserTokens(user.ID); err != nil {
+		return err
+	}
+	disconnectUser(user.ID)
+	return nil
 }
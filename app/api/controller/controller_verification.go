@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/app/mail"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// maxVerificationEmailsPerHour caps how many verification emails one address receives per hour.
+const maxVerificationEmailsPerHour = 5
+
+// ErrEmailNotVerified is returned when an action requires a verified email address.
+var ErrEmailNotVerified = errors.New("email address has not been verified")
+
+// ErrInvalidVerificationToken is returned when an email verification token cannot be used.
+var ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+
+// RateLimitError is returned when a caller must wait before retrying.
+type RateLimitError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Message
+}
+
+// verificationEmails records when verification emails were sent to each address.
+// Limits apply per address whether or not an account exists, so they reveal nothing.
+var verificationEmails = struct {
+	sync.Mutex
+	sent map[string][]time.Time
+}{sent: make(map[string][]time.Time)}
+
+// allowVerificationEmail records a verification email to the address if the rate limit allows it.
+// Otherwise it returns how long the caller must wait.
+func allowVerificationEmail(email string) (time.Duration, bool) {
+	key := strings.ToLower(strings.TrimSpace(email))
+	now := time.Now()
+
+	verificationEmails.Lock()
+	defer verificationEmails.Unlock()
+
+	var recent []time.Time
+	for _, sentAt := range verificationEmails.sent[key] {
+		if now.Sub(sentAt) < time.Hour {
+			recent = append(recent, sentAt)
+		}
+	}
+
+	if n := len(recent); n > 0 {
+		if wait := recent[n-1].Add(config.C.VerificationResendInterval).Sub(now); wait > 0 {
+			verificationEmails.sent[key] = recent
+			return wait, false
+		}
+		if n >= maxVerificationEmailsPerHour {
+			verificationEmails.sent[key] = recent
+			return recent[0].Add(time.Hour).Sub(now), false
+		}
+	}
+
+	verificationEmails.sent[key] = append(recent, now)
+	return 0, true
+}
+
+// sendVerificationEmail issues a new verification token for the user and emails the link.
+func sendVerificationEmail(user *db.User) error {
+	token, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(config.C.EmailVerificationTTL)
+	if err := db.InsertEmailVerificationToken(user.ID, auth.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/user/verify?token=%s", config.C.AppBaseURL, token)
+	return mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Username, config.C.EmailVerificationTTL, link),
+	})
+}
+
+// VerifyEmail marks the email of the token's owner as verified.
+func VerifyEmail(token string) error {
+	if token == "" {
+		return ErrInvalidVerificationToken
+	}
+	_, err := db.VerifyEmail(auth.HashToken(token))
+	if errors.Is(err, db.ErrVerificationTokenInvalid) {
+		return ErrInvalidVerificationToken
+	}
+	return err
+}
+
+// ResendVerificationEmail sends a new verification link to an unverified account.
+// It reports success for unknown or already verified addresses so callers cannot probe for accounts.
+func ResendVerificationEmail(email string) error {
+	if wait, ok := allowVerificationEmail(email); !ok {
+		return &RateLimitError{Message: "too many verification emails requested, try again later", RetryAfter: wait}
+	}
+
+	user, err := db.GetUserByEmail(email)
+	if err != nil || user.EmailVerified {
+		return nil
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("ResendVerificationEmail: failed to send verification email to user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// requireVerifiedEmail returns ErrEmailNotVerified if the user has not verified their email.
+func requireVerifiedEmail(user *db.User) error {
+	if !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"github.com/1akhilpandey/go-messaging/app/mail"
+)
+
+// mailer delivers account emails. It writes to a local outbox until SetMailer is called.
+var mailer mail.Mailer = &mail.OutboxMailer{Dir: "outbox"}
+
+// SetMailer registers the Mailer used to send account emails.
+func SetMailer(m mail.Mailer) {
+	mailer = m
+}
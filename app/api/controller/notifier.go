@@ -0,0 +1,33 @@
+package controller
+
+// Notifier pushes changes made through the API to connected WebSocket clients.
+type Notifier interface {
+	// DisconnectSession closes every connection opened with a token from the session,
+	// or with the API key of that ID.
+	DisconnectSession(sessionID string)
+	// DisconnectUser closes every connection belonging to the user.
+	DisconnectUser(userID int64)
+	// BroadcastToChat sends an event to every connection joined to the chat.
+	BroadcastToChat(chatID int64, eventType string, data interface{})
+	// DisconnectChatMember closes the user's connections to the chat.
+	DisconnectChatMember(chatID, userID int64)
+	// DisconnectChat closes every connection to the chat.
+	DisconnectChat(chatID int64)
+}
+
+// noopNotifier is used until a Notifier is registered with SetNotifier.
+type noopNotifier struct{}
+
+func (noopNotifier) DisconnectSession(string) {}
+func (noopNotifier) DisconnectUser(int64)     {}
+
+func (noopNotifier) BroadcastToChat(int64, string, interface{}) {}
+func (noopNotifier) DisconnectChatMember(int64, int64)          {}
+func (noopNotifier) DisconnectChat(int64)                       {}
+
+var notifier Notifier = noopNotifier{}
+
+// SetNotifier registers the Notifier used to reach connected clients.
+func SetNotifier(n Notifier) {
+	notifier = n
+}
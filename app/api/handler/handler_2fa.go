@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/middleware"
+)
+
+// TwoFactorCodeRequest defines the expected payload for confirming or disabling 2FA.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLoginRequest defines the expected payload for the second login step.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	DeviceName     string `json:"device_name"`
+}
+
+// writeTwoFactorError maps two-factor errors to HTTP status codes.
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	var rateLimitErr *controller.RateLimitError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		writeRateLimitError(w, rateLimitErr)
+	case errors.Is(err, controller.ErrInvalidTOTPCode), errors.Is(err, controller.ErrInvalidChallenge):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, controller.ErrTOTPAlreadyEnabled), errors.Is(err, controller.ErrTOTPNotEnrolled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// EnrollTOTPHandler starts 2FA enrollment and returns the secret for an authenticator app.
+func EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := controller.EnrollTOTP(username)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// ConfirmTOTPHandler enables 2FA and returns the one-time recovery codes.
+func ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := controller.ConfirmTOTP(username, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(codes)
+}
+
+// DisableTOTPHandler turns off 2FA after checking a current code or recovery code.
+func DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := controller.DisableTOTP(username, req.Code); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// TwoFactorLoginHandler completes a login for users with 2FA enabled.
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := controller.CompleteTwoFactorLogin(req.ChallengeToken, req.Code, clientInfo(r, req.DeviceName))
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+)
+
+// UnlockLoginRequest defines the expected payload for clearing a login lockout.
+type UnlockLoginRequest struct {
+	Email     string `json:"email"`
+	IPAddress string `json:"ip_address"`
+}
+
+// UnlockLoginHandler clears failed login attempts and lockouts for an email address or IP address.
+func UnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req UnlockLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	cleared, err := controller.UnlockLogin(req.Email, req.IPAddress)
+	if err != nil {
+		if errors.Is(err, controller.ErrUnlockTargetRequired) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Login lockout cleared", "cleared": cleared})
+}
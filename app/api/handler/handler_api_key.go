@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/middleware"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateAPIKeyRequest defines the expected payload for creating an API key.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateServiceAccountRequest defines the expected payload for creating a service account.
+type CreateServiceAccountRequest struct {
+	Username string `json:"username"`
+}
+
+// writeAPIKeyError maps API key errors to HTTP status codes.
+func writeAPIKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrAPIKeyNotFound), errors.Is(err, controller.ErrServiceAccountNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, controller.ErrAdminScopeNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, controller.ErrInvalidScope), errors.Is(err, controller.ErrInvalidExpiry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func decodeCreateAPIKeyRequest(r *http.Request) (controller.CreateAPIKeyInput, error) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return controller.CreateAPIKeyInput{}, err
+	}
+	return controller.CreateAPIKeyInput{Name: req.Name, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt}, nil
+}
+
+// CreateAPIKeyHandler handles the HTTP POST request to create an API key for the user.
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	input, err := decodeCreateAPIKeyRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := controller.CreateAPIKey(username, input)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// GetAPIKeysHandler handles the HTTP GET request to list the user's API keys.
+func GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := controller.GetAPIKeys(username)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RotateAPIKeyHandler handles the HTTP POST request to replace the secret of one of the user's API keys.
+func RotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key, err := controller.RotateAPIKey(username, chi.URLParam(r, "keyID"))
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// RevokeAPIKeyHandler handles the HTTP DELETE request to revoke one of the user's API keys.
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := controller.RevokeAPIKey(username, chi.URLParam(r, "keyID")); err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+}
+
+// CreateServiceAccountHandler handles the HTTP POST request to create a service account.
+func CreateServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	account, err := controller.CreateServiceAccount(req.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+// GetServiceAccountsHandler handles the HTTP GET request to list service accounts.
+func GetServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	accounts, err := controller.GetServiceAccounts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"service_accounts": accounts, "count": len(accounts)})
+}
+
+// CreateServiceAccountAPIKeyHandler handles the HTTP POST request to create an API key for a service account.
+func CreateServiceAccountAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	input, err := decodeCreateAPIKeyRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := controller.CreateServiceAccountAPIKey(chi.URLParam(r, "accountID"), input)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// GetServiceAccountAPIKeysHandler handles the HTTP GET request to list a service account's API keys.
+func GetServiceAccountAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := controller.GetServiceAccountAPIKeys(chi.URLParam(r, "accountID"))
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RotateServiceAccountAPIKeyHandler handles the HTTP POST request to replace the secret of a service account's API key.
+func RotateServiceAccountAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := controller.RotateServiceAccountAPIKey(chi.URLParam(r, "accountID"), chi.URLParam(r, "keyID"))
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// RevokeServiceAccountAPIKeyHandler handles the HTTP DELETE request to revoke a service account's API key.
+func RevokeServiceAccountAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := controller.RevokeServiceAccountAPIKey(chi.URLParam(r, "accountID"), chi.URLParam(r, "keyID")); err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+}
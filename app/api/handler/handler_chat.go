@@ -2,10 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/1akhilpandey/go-messaging/app/api/controller"
 	"github.com/1akhilpandey/go-messaging/app/middleware"
+	"github.com/1akhilpandey/go-messaging/db"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -18,6 +22,12 @@ type CreateChatRequest struct {
 
 // CreateChatHandler handles the HTTP POST request to create a new chat.
 func CreateChatHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var req CreateChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
@@ -31,8 +41,16 @@ func CreateChatHandler(w http.ResponseWriter, r *http.Request) {
 		IsGroup: req.IsGroup,
 	}
 
-	chat, err := controller.CreateChat(input)
+	chat, err := controller.CreateChat(username, input)
 	if err != nil {
+		if errors.Is(err, controller.ErrEmailNotVerified) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, db.ErrUserNotFound) || errors.Is(err, controller.ErrInvalidDirectChat) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -41,16 +59,57 @@ func CreateChatHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(chat)
 }
 
-// GetChatHandler handles the HTTP GET request to retrieve a chat by ID.
+// DirectChatHandler handles the HTTP POST request to open the one-to-one chat
+// with another user. It responds with 201 Created when the chat is new.
+func DirectChatHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chat, created, err := controller.GetOrCreateDirectChat(username, chi.URLParam(r, "userID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, controller.ErrEmailNotVerified):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, db.ErrUserNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, controller.ErrInvalidDirectChat):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(chat)
+}
+
+// GetChatHandler handles the HTTP GET request to retrieve a page of a chat's messages.
+// The page is selected with the before, after, around, at and limit query parameters;
+// fold_threads=true leaves thread replies out.
 func GetChatHandler(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		http.Error(w, "Chat ID is required", http.StatusBadRequest)
+	access, ok := chatAccess(w, r)
+	if !ok {
 		return
 	}
+	query, ok := parseMessageQuery(w, r)
+	if !ok {
+		return
+	}
+	query.FoldThreads = r.URL.Query().Get("fold_threads") == "true"
 
-	chat, err := controller.GetChat(id)
+	chat, err := controller.GetChat(access, query)
 	if err != nil {
+		if errors.Is(err, controller.ErrInvalidMessageQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -59,6 +118,34 @@ func GetChatHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(chat)
 }
 
+// parseMessageQuery reads the page of messages requested with the before,
+// after, around, at and limit query parameters.
+func parseMessageQuery(w http.ResponseWriter, r *http.Request) (controller.MessageQuery, bool) {
+	params := r.URL.Query()
+	query := controller.MessageQuery{
+		Before: params.Get("before"),
+		After:  params.Get("after"),
+		Around: params.Get("around"),
+	}
+	if v := params.Get("at"); v != "" {
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "at must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return query, false
+		}
+		query.At = &at
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "limit must be a number", http.StatusBadRequest)
+			return query, false
+		}
+		query.Limit = limit
+	}
+	return query, true
+}
+
 // GetUserChatsHandler handles the HTTP GET request to retrieve all chats for the authenticated user.
 func GetUserChatsHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the username from the request context
@@ -69,7 +156,9 @@ func GetUserChatsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get all chats for the user
-	response, err := controller.GetUserChats(username)
+	// Archived chats are hidden unless ?include_archived=true is given.
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
+	response, err := controller.GetUserChats(username, includeArchived)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
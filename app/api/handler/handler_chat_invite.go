@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/middleware"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateChatInviteRequest defines the expected payload for creating a chat invite.
+type CreateChatInviteRequest struct {
+	ExpiresAt        *time.Time `json:"expires_at"`
+	MaxUses          int64      `json:"max_uses"`
+	RequiresApproval bool       `json:"requires_approval"`
+}
+
+// writeChatInviteError maps chat invite errors to HTTP status codes.
+func writeChatInviteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrInviteNotFound), errors.Is(err, db.ErrJoinRequestNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrJoinRequestPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, controller.ErrInvalidExpiry), errors.Is(err, controller.ErrInvalidMaxUses):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeChatMemberError(w, err)
+	}
+}
+
+// CreateChatInviteHandler handles the HTTP POST request to create an invite for a chat.
+func CreateChatInviteHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req CreateChatInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := controller.CreateChatInvite(access, controller.CreateChatInviteInput{
+		ExpiresAt:        req.ExpiresAt,
+		MaxUses:          req.MaxUses,
+		RequiresApproval: req.RequiresApproval,
+	})
+	if err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+// GetChatInvitesHandler handles the HTTP GET request to list a chat's outstanding invites.
+func GetChatInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	invites, err := controller.GetChatInvites(access)
+	if err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// RevokeChatInviteHandler handles the HTTP DELETE request to revoke a chat invite.
+func RevokeChatInviteHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.RevokeChatInvite(access, chi.URLParam(r, "inviteID")); err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Invite revoked"})
+}
+
+// GetChatInviteUsesHandler handles the HTTP GET request to list the joins made with a chat invite.
+func GetChatInviteUsesHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	uses, err := controller.GetChatInviteUses(access, chi.URLParam(r, "inviteID"))
+	if err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uses)
+}
+
+// PreviewChatInviteHandler handles the HTTP GET request to preview the chat behind an invite code.
+func PreviewChatInviteHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	preview, err := controller.PreviewChatInvite(username, chi.URLParam(r, "code"))
+	if err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// AcceptChatInviteHandler handles the HTTP POST request to join a chat with an invite code.
+// It responds with 202 Accepted when the join awaits approval.
+func AcceptChatInviteHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := controller.AcceptChatInvite(username, chi.URLParam(r, "code"))
+	if err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status == controller.InvitePending {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetJoinRequestsHandler handles the HTTP GET request to list a chat's pending join requests.
+func GetJoinRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	requests, err := controller.GetJoinRequests(access)
+	if err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// ApproveJoinRequestHandler handles the HTTP POST request to approve a join request.
+func ApproveJoinRequestHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.ApproveJoinRequest(access, chi.URLParam(r, "requestID")); err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Join request approved"})
+}
+
+// RejectJoinRequestHandler handles the HTTP POST request to reject a join request.
+func RejectJoinRequestHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.RejectJoinRequest(access, chi.URLParam(r, "requestID")); err != nil {
+		writeChatInviteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Join request rejected"})
+}
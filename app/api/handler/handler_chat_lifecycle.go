@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// UpdateChatRequest defines the expected payload for updating a chat. Omitted fields are left unchanged.
+type UpdateChatRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+// writeChatLifecycleError maps errors from changing a chat to HTTP status codes.
+func writeChatLifecycleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, controller.ErrInvalidChatUpdate):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, db.ErrChatArchived), errors.Is(err, db.ErrChatNotArchived):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, db.ErrChatNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		writeChatMemberError(w, err)
+	}
+}
+
+// UpdateChatHandler handles the HTTP PATCH request to change a chat's title, description or avatar.
+func UpdateChatHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req UpdateChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	chat, err := controller.UpdateChat(access, controller.UpdateChatInput{
+		Title:       req.Title,
+		Description: req.Description,
+		AvatarURL:   req.AvatarURL,
+	})
+	if err != nil {
+		writeChatLifecycleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chat)
+}
+
+// ArchiveChatHandler handles the HTTP POST request to archive a chat.
+func ArchiveChatHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	chat, err := controller.ArchiveChat(access)
+	if err != nil {
+		writeChatLifecycleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chat)
+}
+
+// UnarchiveChatHandler handles the HTTP POST request to unarchive a chat.
+func UnarchiveChatHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	chat, err := controller.UnarchiveChat(access)
+	if err != nil {
+		writeChatLifecycleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chat)
+}
+
+// DeleteChatHandler handles the HTTP DELETE request to permanently delete a chat.
+func DeleteChatHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.DeleteChat(access); err != nil {
+		writeChatLifecycleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Chat deleted"})
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/middleware"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// AddChatMembersRequest defines the expected payload for adding members to a chat.
+type AddChatMembersRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// SetChatMemberRoleRequest defines the expected payload for changing a member's role.
+type SetChatMemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// TransferChatOwnershipRequest defines the expected payload for transferring chat ownership.
+type TransferChatOwnershipRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// chatAccess returns the caller's chat membership set by middleware.RequireChatMember.
+func chatAccess(w http.ResponseWriter, r *http.Request) (*controller.ChatAccess, bool) {
+	access, ok := r.Context().Value(middleware.ChatAccessContextKey).(*controller.ChatAccess)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return access, ok
+}
+
+// writeChatMemberError maps chat membership errors to HTTP status codes.
+func writeChatMemberError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, controller.ErrChatPermissionDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, db.ErrNotChatMember), errors.Is(err, db.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrAlreadyChatMember), errors.Is(err, controller.ErrOwnerMustTransfer),
+		errors.Is(err, db.ErrChatArchived):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, controller.ErrNotGroupChat), errors.Is(err, controller.ErrInvalidChatRole),
+		errors.Is(err, controller.ErrInvalidMemberTarget):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetChatMembersHandler handles the HTTP GET request to list a chat's members.
+func GetChatMembersHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := controller.GetChatMembers(access)
+	if err != nil {
+		writeChatMemberError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// AddChatMembersHandler handles the HTTP POST request to add members to a chat.
+func AddChatMembersHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req AddChatMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.UserIDs) == 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	members, err := controller.AddChatMembers(access, req.UserIDs)
+	if err != nil {
+		writeChatMemberError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// RemoveChatMemberHandler handles the HTTP DELETE request to remove a member from a chat.
+func RemoveChatMemberHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.RemoveChatMember(access, chi.URLParam(r, "userID")); err != nil {
+		writeChatMemberError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member removed"})
+}
+
+// LeaveChatHandler handles the HTTP POST request to leave a chat.
+func LeaveChatHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.LeaveChat(access); err != nil {
+		writeChatMemberError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Left the chat"})
+}
+
+// SetChatMemberRoleHandler handles the HTTP PUT request to change a member's role.
+func SetChatMemberRoleHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req SetChatMemberRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := controller.SetChatMemberRole(access, chi.URLParam(r, "userID"), req.Role); err != nil {
+		writeChatMemberError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated"})
+}
+
+// TransferChatOwnershipHandler handles the HTTP POST request to transfer chat ownership.
+func TransferChatOwnershipHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req TransferChatOwnershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := controller.TransferChatOwnership(access, req.UserID); err != nil {
+		writeChatMemberError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Ownership transferred"})
+}
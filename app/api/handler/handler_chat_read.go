@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/middleware"
+)
+
+// MarkChatReadRequest defines the optional payload for marking a chat read.
+// Without a message ID the chat is read up to its latest message.
+type MarkChatReadRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+// MarkChatReadHandler handles the HTTP POST request to mark a chat read up to a message.
+func MarkChatReadHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req MarkChatReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	state, err := controller.MarkChatRead(access, req.MessageID)
+	if err != nil {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// MarkAllChatsReadHandler handles the HTTP POST request to mark every chat of the authenticated user read.
+func MarkAllChatsReadHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	response, err := controller.MarkAllChatsRead(username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/auth"
+)
+
+// JWKSHandler publishes the public keys used to verify tokens issued by this server.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(auth.Keys.JWKS())
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// SendMessageRequest defines the expected payload for sending a message.
+type SendMessageRequest struct {
+	Content      string `json:"content"`
+	ReplyToID    string `json:"reply_to_id"`
+	ThreadRootID string `json:"thread_root_id"`
+	ClientMsgID  string `json:"client_msg_id"`
+}
+
+// EditMessageRequest defines the expected payload for editing a message.
+type EditMessageRequest struct {
+	Content string `json:"content"`
+}
+
+// writeMessageError maps errors from reading or changing a message to HTTP status codes.
+func writeMessageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, controller.ErrInvalidMessage), errors.Is(err, controller.ErrInvalidMessageEdit),
+		errors.Is(err, controller.ErrSystemMessage), errors.Is(err, db.ErrInvalidReply),
+		errors.Is(err, controller.ErrInvalidMessageQuery):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, controller.ErrEmailNotVerified), errors.Is(err, controller.ErrNotMessageAuthor),
+		errors.Is(err, controller.ErrEditWindowClosed), errors.Is(err, controller.ErrChatPermissionDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, db.ErrMessageNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrChatArchived), errors.Is(err, db.ErrMessageDeleted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// SendMessageHandler handles the HTTP POST request to send a message to a chat.
+// It responds with 201 Created, or with 200 OK and the message stored before
+// when the client_msg_id has been used already.
+func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := controller.SendMessage(access, controller.SendMessageInput{
+		Content:      req.Content,
+		ReplyToID:    req.ReplyToID,
+		ThreadRootID: req.ThreadRootID,
+		ClientMsgID:  req.ClientMsgID,
+	})
+	duplicate := errors.Is(err, db.ErrDuplicateMessage)
+	if err != nil && !duplicate {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !duplicate {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(msg)
+}
+
+// GetThreadHandler handles the HTTP GET request to retrieve a page of the replies to a message.
+// The page is selected like the chat history.
+func GetThreadHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	query, ok := parseMessageQuery(w, r)
+	if !ok {
+		return
+	}
+
+	thread, err := controller.GetThread(access, chi.URLParam(r, "messageID"), query)
+	if err != nil {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+// EditMessageHandler handles the HTTP PATCH request to edit one of the caller's messages.
+func EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	var req EditMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := controller.EditMessage(access, chi.URLParam(r, "messageID"), req.Content)
+	if err != nil {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// DeleteMessageHandler handles the HTTP DELETE request to delete a message for everyone in the chat.
+func DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := controller.DeleteMessage(access, chi.URLParam(r, "messageID"))
+	if err != nil {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// HideMessageHandler handles the HTTP POST request to hide a message from the caller only.
+func HideMessageHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.HideMessage(access, chi.URLParam(r, "messageID")); err != nil {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Message hidden"})
+}
+
+// UnhideMessageHandler handles the HTTP DELETE request to show a hidden message again.
+func UnhideMessageHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	if err := controller.UnhideMessage(access, chi.URLParam(r, "messageID")); err != nil {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Message unhidden"})
+}
+
+// GetMessageHistoryHandler handles the HTTP GET request to list a message's earlier revisions.
+func GetMessageHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := controller.GetMessageHistory(access, chi.URLParam(r, "messageID"))
+	if err != nil {
+		writeMessageError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// writeReactionError maps errors from changing reactions to HTTP status codes.
+func writeReactionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, controller.ErrInvalidReaction):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, db.ErrReactionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		writeMessageError(w, err)
+	}
+}
+
+// reactionParams returns the message ID and the URL-decoded emoji of a reaction route.
+func reactionParams(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil {
+		http.Error(w, controller.ErrInvalidReaction.Error(), http.StatusBadRequest)
+		return "", "", false
+	}
+	return chi.URLParam(r, "messageID"), emoji, true
+}
+
+// AddReactionHandler handles the HTTP PUT request to react to a message with an emoji.
+func AddReactionHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	messageID, emoji, ok := reactionParams(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := controller.AddReaction(access, messageID, emoji)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// RemoveReactionHandler handles the HTTP DELETE request to remove the caller's reaction to a message.
+func RemoveReactionHandler(w http.ResponseWriter, r *http.Request) {
+	access, ok := chatAccess(w, r)
+	if !ok {
+		return
+	}
+	messageID, emoji, ok := reactionParams(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := controller.RemoveReaction(access, messageID, emoji)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/oidc"
+)
+
+// OIDCLoginHandler redirects the user to the identity provider to sign in.
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	authURL, err := controller.StartOIDCLogin(r.Context())
+	if err != nil {
+		if errors.Is(err, controller.ErrOIDCNotConfigured) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler completes the sign-in when the identity provider
+// redirects back, and responds like a password login: with tokens, or with a
+// two-factor challenge.
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		msg := "Sign-in failed: " + providerErr
+		if desc := query.Get("error_description"); desc != "" {
+			msg += " (" + desc + ")"
+		}
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "state and code are required", http.StatusBadRequest)
+		return
+	}
+
+	response, err := controller.CompleteOIDCLogin(r.Context(), state, code, clientInfo(r, ""))
+	if err != nil {
+		switch {
+		case errors.Is(err, controller.ErrOIDCNotConfigured):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, controller.ErrInvalidOIDCState):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, controller.ErrOIDCEmailNotVerified):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, controller.ErrOIDCAccountNotVerified):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
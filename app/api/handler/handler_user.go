@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/middleware"
 	"github.com/gorilla/mux"
 )
 
@@ -43,8 +45,9 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 // LoginRequest defines the expected payload for login.
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"`
 }
 
 // LoginUserHandler handles login requests.
@@ -55,14 +58,51 @@ func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := controller.LoginUser(req.Email, req.Password)
+	tokens, err := controller.LoginUser(req.Email, req.Password, clientInfo(r, req.DeviceName))
 	if err != nil {
+		var rateLimitErr *controller.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			writeRateLimitError(w, rateLimitErr)
+			return
+		}
+		if errors.Is(err, controller.ErrEmailNotVerified) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RefreshTokenRequest defines the expected payload for refreshing tokens.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	DeviceName   string `json:"device_name"`
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new token pair.
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := controller.RefreshTokens(req.RefreshToken, clientInfo(r, req.DeviceName))
+	if err != nil {
+		if errors.Is(err, controller.ErrInvalidRefreshToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
 }
 
 // LogoutUserHandler handles logout requests.app
@@ -87,6 +127,21 @@ func LogoutUserHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully logged out"})
 }
 
+// LogoutAllUserHandler handles requests to revoke all of the user's sessions.
+func LogoutAllUserHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(middleware.UserContextKey).(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := controller.LogoutAllUser(username); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Successfully logged out of all sessions"})
+}
+
 // GetUserHandler handles the HTTP GET request to retrieve a user by ID.
 func GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+)
+
+// writeRateLimitError responds with 429 Too Many Requests and a Retry-After header.
+func writeRateLimitError(w http.ResponseWriter, err *controller.RateLimitError) {
+	seconds := int(math.Ceil(err.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+// VerifyEmailHandler handles the HTTP GET request that confirms a user's email address.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if err := controller.VerifyEmail(token); err != nil {
+		if errors.Is(err, controller.ErrInvalidVerificationToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email address verified"})
+}
+
+// ResendVerificationRequest defines the expected payload for resending a verification email.
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// ResendVerificationHandler handles requests to send a new email verification link.
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := controller.ResendVerificationEmail(req.Email); err != nil {
+		var rateLimitErr *controller.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			writeRateLimitError(w, rateLimitErr)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If this email belongs to an unverified account, a verification link has been sent"})
+}
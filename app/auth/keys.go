@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// KeyConfig describes the signing keys loaded from the JWT keys file.
+//
+// Example:
+//
+//	{
+//	  "active_kid": "2025-06",
+//	  "keys": [
+//	    {"kid": "2025-06", "alg": "EdDSA", "private_key_file": "keys/ed25519.pem"},
+//	    {"kid": "2025-01", "alg": "RS256", "public_key_file": "keys/rsa.pub.pem"}
+//	  ]
+//	}
+//
+// Keys without a private key (or secret) are verification-only, which allows
+// tokens signed by a retired key to stay valid while the key is rotated out.
+type KeyConfig struct {
+	ActiveKID string           `json:"active_kid"`
+	Keys      []KeyConfigEntry `json:"keys"`
+}
+
+// KeyConfigEntry describes a single signing or verification key.
+type KeyConfigEntry struct {
+	KID            string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	Secret         string `json:"secret,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+}
+
+// SigningKey is a key that can verify, and optionally sign, tokens.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the key holds private material.
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// KeyManager holds the active signing key and every key accepted for verification.
+type KeyManager struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+	// order preserves configuration order for tokens without a "kid" header.
+	order []*SigningKey
+}
+
+// Keys is the key manager used to sign and verify tokens.
+var Keys *KeyManager
+
+// InitKeys builds the key manager from the keys file, or from the HS256 secret
+// when no file is given, and assigns it to the package-level Keys variable.
+func InitKeys(keysFile, secret string) (*KeyManager, error) {
+	var cfg KeyConfig
+	if keysFile != "" {
+		data, err := os.ReadFile(keysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT keys file: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse JWT keys file: %w", err)
+		}
+	} else {
+		if secret == "" {
+			return nil, errors.New("a JWT keys file or secret is required")
+		}
+		cfg = KeyConfig{
+			ActiveKID: "default",
+			Keys:      []KeyConfigEntry{{KID: "default", Algorithm: AlgHS256, Secret: secret}},
+		}
+	}
+
+	km, err := NewKeyManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+	Keys = km
+	return km, nil
+}
+
+// NewKeyManager creates a key manager from the given configuration.
+func NewKeyManager(cfg KeyConfig) (*KeyManager, error) {
+	km := &KeyManager{keys: make(map[string]*SigningKey)}
+	for _, entry := range cfg.Keys {
+		if entry.KID == "" {
+			return nil, errors.New("every JWT key must have a kid")
+		}
+		if _, exists := km.keys[entry.KID]; exists {
+			return nil, fmt.Errorf("duplicate JWT key id %q", entry.KID)
+		}
+		key, err := loadKey(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT key %q: %w", entry.KID, err)
+		}
+		km.keys[key.ID] = key
+		km.order = append(km.order, key)
+	}
+
+	active, ok := km.keys[cfg.ActiveKID]
+	if !ok {
+		return nil, fmt.Errorf("active JWT key %q is not configured", cfg.ActiveKID)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("active JWT key %q has no private key", cfg.ActiveKID)
+	}
+	km.active = active
+	return km, nil
+}
+
+func loadKey(entry KeyConfigEntry) (*SigningKey, error) {
+	key := &SigningKey{ID: entry.KID}
+	switch entry.Algorithm {
+	case AlgHS256:
+		if entry.Secret == "" {
+			return nil, errors.New("HS256 keys require a secret")
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.signKey = []byte(entry.Secret)
+		key.verifyKey = []byte(entry.Secret)
+	case AlgRS256:
+		key.Method = jwt.SigningMethodRS256
+		if entry.PrivateKeyFile != "" {
+			data, err := os.ReadFile(entry.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = priv
+			key.verifyKey = &priv.PublicKey
+		} else if entry.PublicKeyFile != "" {
+			data, err := os.ReadFile(entry.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			pub, err := jwt.ParseRSAPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = pub
+		} else {
+			return nil, errors.New("RS256 keys require a private_key_file or public_key_file")
+		}
+	case AlgEdDSA:
+		key.Method = jwt.SigningMethodEdDSA
+		if entry.PrivateKeyFile != "" {
+			data, err := os.ReadFile(entry.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			edPriv, ok := priv.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("EdDSA private key is not an Ed25519 key")
+			}
+			key.signKey = edPriv
+			key.verifyKey = edPriv.Public()
+		} else if entry.PublicKeyFile != "" {
+			data, err := os.ReadFile(entry.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			pub, err := jwt.ParseEdPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = pub
+		} else {
+			return nil, errors.New("EdDSA keys require a private_key_file or public_key_file")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", entry.Algorithm)
+	}
+	return key, nil
+}
+
+// Sign signs the claims with the active key and sets the "kid" header.
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(km.active.Method, claims)
+	token.Header["kid"] = km.active.ID
+	return token.SignedString(km.active.signKey)
+}
+
+// Parse verifies the token signature against the configured keys and
+// validates the standard claims.
+func (km *KeyManager) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, km.keyfunc)
+}
+
+// keyfunc selects the verification key by the token's "kid" header. Tokens
+// issued before key IDs were introduced fall back to the first configured key
+// using the same algorithm.
+func (km *KeyManager) keyfunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		key, ok := km.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if key.Method.Alg() != alg {
+			return nil, fmt.Errorf("unexpected signing method: %v", alg)
+		}
+		return key.verifyKey, nil
+	}
+	for _, key := range km.order {
+		if key.Method.Alg() == alg {
+			return key.verifyKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", alg)
+}
+
+// JWK is a JSON Web Key as published in the JWKS document.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA public key parameters.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 public key parameters.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys. Symmetric keys are never published.
+func (km *KeyManager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range km.order {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
@@ -0,0 +1,34 @@
+package auth
+
+import "strings"
+
+// APIKeyPrefix starts every API key so keys can be told apart from JWTs
+// and spotted by secret scanners.
+const APIKeyPrefix = "gm_"
+
+// Scopes that can be granted to API keys. Sessions started with a password
+// or single sign-on are not limited by scopes.
+const (
+	ScopeChatRead     = "chat:read"
+	ScopeChatWrite    = "chat:write"
+	ScopeMessageWrite = "message:write"
+	ScopeAdmin        = "admin"
+)
+
+// Scopes lists every valid scope.
+var Scopes = []string{ScopeChatRead, ScopeChatWrite, ScopeMessageWrite, ScopeAdmin}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKey reports whether the bearer credential is an API key rather than a JWT.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	// RFC 6238 appendix B lists 8-digit codes; 6-digit codes are their last six digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, at)
+		if !ok {
+			t.Errorf("ValidateTOTP(%s at %d) = false, want true", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(%s at %d) step = %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		want   bool
+	}{
+		{name: "current period", secret: rfc6238Secret, code: "050471", at: at, want: true},
+		{name: "lowercase secret", secret: strings.ToLower(rfc6238Secret), code: "050471", at: at, want: true},
+		{name: "one period late", secret: rfc6238Secret, code: "050471", at: at.Add(totpPeriod * time.Second), want: true},
+		{name: "one period early", secret: rfc6238Secret, code: "050471", at: at.Add(-totpPeriod * time.Second), want: true},
+		{name: "two periods late", secret: rfc6238Secret, code: "050471", at: at.Add(2 * totpPeriod * time.Second), want: false},
+		{name: "wrong code", secret: rfc6238Secret, code: "050472", at: at, want: false},
+		{name: "eight digits", secret: rfc6238Secret, code: "14050471", at: at, want: false},
+		{name: "invalid secret", secret: "not base32!", code: "050471", at: at, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, tt.at); ok != tt.want {
+				t.Errorf("ValidateTOTP = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
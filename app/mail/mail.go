@@ -0,0 +1,13 @@
+package mail
+
+// Message is an email to deliver.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(msg Message) error
+}
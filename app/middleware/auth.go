@@ -2,18 +2,34 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
 
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/db"
 	"github.com/golang-jwt/jwt/v4"
 )
 
 // UserContextKey is the key for user information in the request context.
 const UserContextKey = "username"
 
-// AuthMiddleware validates the JWT provided in the Authorization header
+// SessionContextKey is the key for the session (token family) ID in the request context.
+// It is not set for requests authenticated with an API key.
+const SessionContextKey = "session"
+
+// ScopesContextKey is the key for the API key's scopes in the request context.
+// It is not set for requests authenticated with a session token.
+const ScopesContextKey = "scopes"
+
+// APIKeyContextKey is the key for the API key ID in the request context.
+// It is not set for requests authenticated with a session token.
+const APIKeyContextKey = "api_key"
+
+// AuthMiddleware validates the JWT or API key provided in the Authorization header,
+// rejects tokens that have been revoked in user_tokens,
 // and attaches the token claims to the request context.
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -30,15 +46,12 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 		tokenString := parts[1]
 
-		secretKey := []byte("mysecret")
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return secretKey, nil
-		})
+		if auth.IsAPIKey(tokenString) {
+			authenticateAPIKey(next, w, r, tokenString)
+			return
+		}
 
+		token, err := auth.Keys.Parse(tokenString, jwt.MapClaims{})
 		if err != nil || !token.Valid {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
@@ -51,6 +64,12 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Only access tokens are accepted; other tokens (e.g. login challenges) carry a "typ" claim.
+		if typ, ok := claims["typ"]; ok && typ != "access" {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
 		username, ok := claims["username"].(string)
 		if !ok {
 			// Handle the error: Username claim is not a string or not present
@@ -58,7 +77,44 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+
+		// Reject tokens that were revoked (e.g. on logout) or are no longer stored.
+		storedToken, err := db.GetActiveUserToken(tokenString)
+		if err != nil {
+			if errors.Is(err, db.ErrTokenInactive) {
+				http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+				return
+			}
+			fmt.Println("Token lookup failed:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		ctx := context.WithValue(r.Context(), UserContextKey, username)
+		ctx = context.WithValue(ctx, SessionContextKey, storedToken.FamilyID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// authenticateAPIKey serves the request as the owner of the API key, limited to the key's scopes.
+func authenticateAPIKey(next http.Handler, w http.ResponseWriter, r *http.Request, key string) {
+	apiKey, err := db.GetActiveAPIKey(auth.HashToken(key))
+	if err != nil {
+		if errors.Is(err, db.ErrTokenInactive) {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		fmt.Println("API key lookup failed:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	user, err := db.GetUserByID(apiKey.UserID)
+	if err != nil {
+		fmt.Println("API key owner lookup failed:", err)
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	ctx := context.WithValue(r.Context(), UserContextKey, user.Username)
+	ctx = context.WithValue(ctx, ScopesContextKey, apiKey.Scopes)
+	ctx = context.WithValue(ctx, APIKeyContextKey, apiKey.ID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
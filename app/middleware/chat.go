@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// ChatAccessContextKey is the key for the caller's *controller.ChatAccess in the request context.
+const ChatAccessContextKey = "chat_access"
+
+// ChatIDExtractor returns the chat ID a request refers to.
+type ChatIDExtractor func(r *http.Request) string
+
+// ChatIDFromURLParam reads the chat ID from a route parameter.
+func ChatIDFromURLParam(name string) ChatIDExtractor {
+	return func(r *http.Request) string {
+		return chi.URLParam(r, name)
+	}
+}
+
+// ChatIDFromQuery reads the chat ID from a query parameter.
+func ChatIDFromQuery(name string) ChatIDExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// RequireChatMember allows the request only if the authenticated user is a
+// member of the chat identified by chatID. Missing or malformed chat IDs get
+// 400, unknown chats get 404 and chats the user does not belong to get 403.
+// It must run after AuthMiddleware.
+func RequireChatMember(chatID ChatIDExtractor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, ok := r.Context().Value(UserContextKey).(string)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			id := chatID(r)
+			if id == "" {
+				http.Error(w, "Chat ID is required", http.StatusBadRequest)
+				return
+			}
+			if n, err := strconv.ParseInt(id, 10, 64); err != nil || n <= 0 {
+				http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+				return
+			}
+
+			access, err := controller.AuthorizeChat(username, id)
+			if err != nil {
+				switch {
+				case errors.Is(err, db.ErrChatNotFound):
+					http.Error(w, err.Error(), http.StatusNotFound)
+				case errors.Is(err, db.ErrNotChatMember):
+					http.Error(w, err.Error(), http.StatusForbidden)
+				default:
+					fmt.Println("Chat authorization failed:", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ChatAccessContextKey, access)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
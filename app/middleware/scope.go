@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// HasScope reports whether the request may act with the given scope.
+// Session tokens carry every scope; API keys carry only the scopes they were created with.
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, ok := ctx.Value(ScopesContextKey).([]string)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope allows the request only if it may act with the given scope.
+// It must run after AuthMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasScope(r.Context(), scope) {
+				http.Error(w, "API key is missing the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession allows the request only if it was authenticated with a session
+// token rather than an API key. It protects account management, so a leaked API
+// key cannot be used to create further keys or end the owner's sessions.
+// It must run after AuthMiddleware.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(SessionContextKey).(string); !ok {
+			http.Error(w, "This endpoint requires a login session", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,11 +2,14 @@ package ws
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/auth"
 	"github.com/1akhilpandey/go-messaging/app/middleware"
 	"github.com/1akhilpandey/go-messaging/db"
 	"github.com/gorilla/websocket"
@@ -39,6 +42,16 @@ type Client struct {
 	UserID int64
 	// ChatID this client is associated with (Needs to be populated on joining a chat/connection)
 	ChatID int64
+	// SessionID of the token or ID of the API key the connection was opened with,
+	// used to close it on revocation.
+	SessionID string
+	// ReadOnly clients receive messages but may not send them (e.g. unverified
+	// email or an API key without the message:write scope).
+	ReadOnly bool
+	// access is the client's membership of the chat, checked when it joined.
+	access *controller.ChatAccess
+	// eventLimiter limits the typing and other events the client may send.
+	eventLimiter rateLimiter
 }
 
 // ServeWs handles websocket requests from the peer.
@@ -51,6 +64,11 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sessionID, _ := r.Context().Value(middleware.SessionContextKey).(string)
+	if keyID, ok := r.Context().Value(middleware.APIKeyContextKey).(string); ok {
+		sessionID = keyID
+	}
+
 	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
@@ -59,6 +77,14 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Membership of the chat was checked by RequireChatMember.
+	access, ok := r.Context().Value(middleware.ChatAccessContextKey).(*controller.ChatAccess)
+	if !ok {
+		log.Println("ServeWs: Missing chat access in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	// Get chat ID from query parameter
 	chatIDStr := r.URL.Query().Get("chat_id")
 	if chatIDStr == "" {
@@ -89,11 +115,14 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &Client{
-		Hub:    hub,
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
-		UserID: userID,
-		ChatID: chatID,
+		Hub:       hub,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
+		UserID:    userID,
+		ChatID:    chatID,
+		SessionID: sessionID,
+		ReadOnly:  !user.EmailVerified || !middleware.HasScope(r.Context(), auth.ScopeMessageWrite),
+		access:    access,
 	}
 	client.Hub.Register <- client
 
@@ -103,12 +132,45 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 }
 
 // WsMessage defines the expected structure for incoming websocket messages.
+// Type is empty for a chat message, or names a typing event.
+// ReplyToID and ThreadRootID are optional message IDs, as in the REST API.
+// ClientMsgID is an optional ID chosen by the client; a message sent again
+// with the same ID is acknowledged but not stored or broadcast twice.
 type WsMessage struct {
-	Content string `json:"content"`
-	ChatID  int64  `json:"chat_id,omitempty"`
+	Type         string `json:"type,omitempty"`
+	Content      string `json:"content"`
+	ChatID       int64  `json:"chat_id,omitempty"`
+	ReplyToID    string `json:"reply_to_id,omitempty"`
+	ThreadRootID string `json:"thread_root_id,omitempty"`
+	ClientMsgID  string `json:"client_msg_id,omitempty"`
 }
 
-// readPump pumps messages from the websocket connection to the hub.
+// Events sent only to the client whose message they answer.
+const (
+	// EventMessageAck confirms that a message was stored.
+	EventMessageAck = "message.ack"
+	// EventError reports that a message was rejected.
+	EventError = "error"
+)
+
+// AckEvent is the data of an EventMessageAck event. Duplicate is set when the
+// message had been stored already under the same client message ID.
+type AckEvent struct {
+	ClientMsgID string    `json:"client_msg_id,omitempty"`
+	ID          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Duplicate   bool      `json:"duplicate,omitempty"`
+}
+
+// ErrorEvent is the data of an EventError event.
+type ErrorEvent struct {
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	Error       string `json:"error"`
+}
+
+// readPump pumps messages from the websocket connection to the hub. Stored
+// messages reach the chat as message.created events, like those sent with
+// the REST API.
 func (c *Client) readPump() {
 	defer func() {
 		c.Hub.Unregister <- c
@@ -128,52 +190,73 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-		// Attempt to parse the message and persist it
 		var wsMsg WsMessage
 		if err := json.Unmarshal(message, &wsMsg); err != nil {
-			log.Printf("readPump: Error unmarshalling message: %v", err)
-		} else {
-			// Persist the message if UserID and ChatID are set
-			if c.UserID != 0 && c.ChatID != 0 {
-				dbMsg := &db.Message{
-					ChatID:  c.ChatID,
-					UserID:  c.UserID,
-					Content: wsMsg.Content,
-					// CreatedAt/UpdatedAt handled by db.InsertMessage or DB defaults
-				}
-				if err := db.InsertMessage(dbMsg); err != nil {
-					log.Printf("readPump: Error inserting message: %v", err)
-				}
-			} else {
-				// Log if context is missing
-				log.Printf("Skipping persistence due to missing context (User: %d, Chat: %d)", c.UserID, c.ChatID)
-			}
+			log.Printf("readPump: Rejecting malformed message (User: %d): %v", c.UserID, err)
+			c.sendError("", "malformed message")
+			continue
+		}
+		if wsMsg.Type != "" {
+			c.handleEvent(wsMsg.Type)
+			continue
+		}
+		if c.ReadOnly {
+			log.Printf("readPump: Dropping message from read-only client (User: %d)", c.UserID)
+			c.sendError(wsMsg.ClientMsgID, "sending messages is not allowed")
+			continue
 		}
 
-		// Add the chat ID to the message before broadcasting
-		var broadcastMsg WsMessage
-		if err := json.Unmarshal(message, &broadcastMsg); err != nil {
-			log.Printf("readPump: Error unmarshalling message for broadcast: %v", err)
-			// Still broadcast the original message if we can't unmarshal it
-			c.Hub.Broadcast <- message
-		} else {
-			// Set the chat ID in the message
-			broadcastMsg.ChatID = c.ChatID
-
-			// Marshal the message back to bytes
-			modifiedMessage, err := json.Marshal(broadcastMsg)
-			if err != nil {
-				log.Printf("readPump: Error marshalling message with chat ID: %v", err)
-				// Fallback to original message
-				c.Hub.Broadcast <- message
-			} else {
-				// Broadcast the modified message with chat ID
-				c.Hub.Broadcast <- modifiedMessage
-			}
+		msg, err := controller.SendMessage(c.access, controller.SendMessageInput{
+			Content:      wsMsg.Content,
+			ReplyToID:    wsMsg.ReplyToID,
+			ThreadRootID: wsMsg.ThreadRootID,
+			ClientMsgID:  wsMsg.ClientMsgID,
+		})
+		switch {
+		case err == nil:
+			c.Hub.SendToClient(c, EventMessageAck, ackEvent(msg, false))
+			// Sending a message ends typing it.
+			c.Hub.SetTyping(c, false)
+		case errors.Is(err, db.ErrDuplicateMessage):
+			// A retry of a message that was stored and broadcast already.
+			c.Hub.SendToClient(c, EventMessageAck, ackEvent(msg, true))
+		case errors.Is(err, controller.ErrInvalidMessage), errors.Is(err, controller.ErrEmailNotVerified),
+			errors.Is(err, db.ErrInvalidReply), errors.Is(err, db.ErrChatArchived):
+			c.sendError(wsMsg.ClientMsgID, err.Error())
+		default:
+			log.Printf("readPump: Error sending message (User: %d, Chat: %d): %v", c.UserID, c.ChatID, err)
+			c.sendError(wsMsg.ClientMsgID, "failed to store message")
 		}
 	}
 }
 
+// handleEvent relays a typing event from the client. Events beyond the
+// client's rate limit are dropped without a reply.
+func (c *Client) handleEvent(eventType string) {
+	if !c.eventLimiter.allow(time.Now()) {
+		return
+	}
+	if eventType != EventTypingStart && eventType != EventTypingStop {
+		c.sendError("", "unknown event type")
+		return
+	}
+	if c.ReadOnly {
+		c.sendError("", "sending messages is not allowed")
+		return
+	}
+	c.Hub.SetTyping(c, eventType == EventTypingStart)
+}
+
+// sendError tells the client that its message was rejected.
+func (c *Client) sendError(clientMsgID, reason string) {
+	c.Hub.SendToClient(c, EventError, ErrorEvent{ClientMsgID: clientMsgID, Error: reason})
+}
+
+// ackEvent describes a stored message to the client that sent it.
+func ackEvent(msg controller.MessageResponse, duplicate bool) AckEvent {
+	return AckEvent{ClientMsgID: msg.ClientMsgID, ID: msg.ID, CreatedAt: msg.CreatedAt, Duplicate: duplicate}
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
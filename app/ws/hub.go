@@ -1,5 +1,19 @@
 package ws
 
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Event is a change pushed to the clients of a chat. The writePump routes it
+// by ChatID like any other message.
+type Event struct {
+	Type   string      `json:"type"`
+	ChatID int64       `json:"chat_id"`
+	Data   interface{} `json:"data"`
+}
+
 // Hub maintains the set of active clients and broadcasts messages to the clients.
 type Hub struct {
 	// Registered clients.
@@ -10,6 +24,19 @@ type Hub struct {
 	Register chan *Client
 	// Unregister requests from clients.
 	Unregister chan *Client
+	// Requests to close the connections of every client matching a predicate.
+	disconnect chan func(*Client) bool
+	// Messages for a single client, such as replies to what it sent.
+	direct chan directMessage
+	// Clients starting or stopping to type, and the users typing in each chat.
+	typingUpdates chan typingUpdate
+	typing        map[typingKey]typingState
+}
+
+// directMessage is a message for a single client.
+type directMessage struct {
+	client  *Client
+	message []byte
 }
 
 // NewHub creates a new Hub.
@@ -19,11 +46,61 @@ func NewHub() *Hub {
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Clients:    make(map[*Client]bool),
+		disconnect: make(chan func(*Client) bool),
+		direct:     make(chan directMessage),
+
+		typingUpdates: make(chan typingUpdate),
+		typing:        make(map[typingKey]typingState),
 	}
 }
 
-// Run processes incoming register, unregister, and broadcast requests.
+// DisconnectSession closes every connection opened with a token from the given session,
+// or with the API key of that ID.
+func (h *Hub) DisconnectSession(sessionID string) {
+	h.disconnect <- func(c *Client) bool { return c.SessionID == sessionID }
+}
+
+// DisconnectUser closes every connection belonging to the given user.
+func (h *Hub) DisconnectUser(userID int64) {
+	h.disconnect <- func(c *Client) bool { return c.UserID == userID }
+}
+
+// BroadcastToChat sends an event to every client joined to the given chat.
+func (h *Hub) BroadcastToChat(chatID int64, eventType string, data interface{}) {
+	message, err := json.Marshal(Event{Type: eventType, ChatID: chatID, Data: data})
+	if err != nil {
+		log.Printf("BroadcastToChat: Error marshalling %s event: %v", eventType, err)
+		return
+	}
+	h.Broadcast <- message
+}
+
+// SendToClient sends an event to a single client. It is dropped if the client
+// has disconnected.
+func (h *Hub) SendToClient(client *Client, eventType string, data interface{}) {
+	message, err := json.Marshal(Event{Type: eventType, ChatID: client.ChatID, Data: data})
+	if err != nil {
+		log.Printf("SendToClient: Error marshalling %s event: %v", eventType, err)
+		return
+	}
+	h.direct <- directMessage{client: client, message: message}
+}
+
+// DisconnectChatMember closes the given user's connections to the given chat.
+func (h *Hub) DisconnectChatMember(chatID, userID int64) {
+	h.disconnect <- func(c *Client) bool { return c.ChatID == chatID && c.UserID == userID }
+}
+
+// DisconnectChat closes every connection to the given chat.
+func (h *Hub) DisconnectChat(chatID int64) {
+	h.disconnect <- func(c *Client) bool { return c.ChatID == chatID }
+}
+
+// Run processes incoming register, unregister, broadcast and typing requests,
+// and times out typing users.
 func (h *Hub) Run() {
+	typingSweep := time.NewTicker(typingSweepPeriod)
+	defer typingSweep.Stop()
 	for {
 		select {
 		case client := <-h.Register:
@@ -32,16 +109,55 @@ func (h *Hub) Run() {
 			if _, ok := h.Clients[client]; ok {
 				delete(h.Clients, client)
 				close(client.Send)
+				h.clientGone(client)
 			}
-		case message := <-h.Broadcast:
+		case match := <-h.disconnect:
+			// Closing the send channel makes the write pump close the connection.
+			var gone []*Client
 			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
+				if match(client) {
 					delete(h.Clients, client)
+					close(client.Send)
+					gone = append(gone, client)
 				}
 			}
+			h.clientsGone(gone)
+		case direct := <-h.direct:
+			// The send channel is closed once the client is unregistered.
+			if _, ok := h.Clients[direct.client]; ok && !h.deliver(direct.client, direct.message) {
+				h.clientGone(direct.client)
+			}
+		case update := <-h.typingUpdates:
+			h.updateTyping(update)
+		case now := <-typingSweep.C:
+			h.expireTyping(now)
+		case message := <-h.Broadcast:
+			h.broadcast(message)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// broadcast queues a message for every registered client.
+func (h *Hub) broadcast(message []byte) {
+	var dropped []*Client
+	for client := range h.Clients {
+		if !h.deliver(client, message) {
+			dropped = append(dropped, client)
+		}
+	}
+	h.clientsGone(dropped)
+}
+
+// deliver queues a message for a registered client. If the client's buffer is
+// full, the client is dropped and deliver returns false; the caller must then
+// call clientGone for it, after it is done ranging over h.Clients.
+func (h *Hub) deliver(client *Client, message []byte) bool {
+	select {
+	case client.Send <- message:
+		return true
+	default:
+		close(client.Send)
+		delete(h.Clients, client)
+		return false
+	}
+}
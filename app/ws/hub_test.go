@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// newTestClient registers a client of the user in the chat. A buffer of 0 makes
+// every delivery to the client fail, as if it had stopped reading.
+func newTestClient(h *Hub, chatID, userID int64, buffer int) *Client {
+	client := &Client{Hub: h, ChatID: chatID, UserID: userID, Send: make(chan []byte, buffer)}
+	h.Clients[client] = true
+	return client
+}
+
+// typingEvents returns the typing events queued for the client, as "type user_id".
+func typingEvents(t *testing.T, client *Client) []string {
+	t.Helper()
+	var events []string
+	for {
+		select {
+		case message, ok := <-client.Send:
+			if !ok {
+				return events
+			}
+			var event struct {
+				Type string      `json:"type"`
+				Data TypingEvent `json:"data"`
+			}
+			if err := json.Unmarshal(message, &event); err != nil {
+				t.Fatalf("failed to decode %s: %v", message, err)
+			}
+			if event.Type == EventTypingStart || event.Type == EventTypingStop {
+				events = append(events, event.Type+" "+event.Data.UserID)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func startTyping(h *Hub, client *Client) {
+	h.updateTyping(typingUpdate{client: client, username: strconv.FormatInt(client.UserID, 10), typing: true})
+}
+
+func TestDroppedClientStopsTyping(t *testing.T) {
+	tests := []struct {
+		name string
+		// drop makes the hub deliver to the typing client, whose buffer is full.
+		drop func(h *Hub, typer *Client)
+		// want are the typing events the watcher receives after the drop.
+		want []string
+	}{
+		{
+			name: "broadcast",
+			drop: func(h *Hub, typer *Client) {
+				h.broadcast([]byte(`{"type":"message.created","chat_id":1}`))
+			},
+			want: []string{"typing.stop 1"},
+		},
+		{
+			name: "typing event",
+			drop: func(h *Hub, typer *Client) {
+				startTyping(h, newTestClient(h, 1, 3, 8))
+			},
+			want: []string{"typing.start 3", "typing.stop 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub()
+			typer := newTestClient(h, 1, 1, 0)
+			watcher := newTestClient(h, 1, 2, 8)
+			startTyping(h, typer)
+			if got := typingEvents(t, watcher); len(got) != 1 || got[0] != "typing.start 1" {
+				t.Fatalf("watcher received %v, want [typing.start 1]", got)
+			}
+
+			tt.drop(h, typer)
+			if _, ok := h.Clients[typer]; ok {
+				t.Fatal("client with a full buffer was not dropped")
+			}
+			if _, ok := h.typing[typingKey{chatID: 1, userID: 1}]; ok {
+				t.Error("dropped client's user is still typing")
+			}
+			got := typingEvents(t, watcher)
+			if len(got) != len(tt.want) {
+				t.Fatalf("watcher received %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("watcher received %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDroppedClientKeepsTypingOnOtherConnection(t *testing.T) {
+	h := NewHub()
+	typer := newTestClient(h, 1, 1, 0)
+	newTestClient(h, 1, 1, 8)
+	watcher := newTestClient(h, 1, 2, 8)
+	startTyping(h, typer)
+	typingEvents(t, watcher)
+
+	h.broadcast([]byte(`{"type":"message.created","chat_id":1}`))
+	if _, ok := h.typing[typingKey{chatID: 1, userID: 1}]; !ok {
+		t.Error("user stopped typing while still connected to the chat")
+	}
+	if got := typingEvents(t, watcher); len(got) != 0 {
+		t.Errorf("watcher received %v, want no typing events", got)
+	}
+}
@@ -0,0 +1,161 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Typing events are relayed to the other members of a chat and never stored.
+const (
+	EventTypingStart = "typing.start"
+	EventTypingStop  = "typing.stop"
+)
+
+const (
+	// A user stops typing if no typing.start is received for this long.
+	typingTimeout = 8 * time.Second
+
+	// How often the hub looks for users whose typing has timed out.
+	typingSweepPeriod = time.Second
+
+	// Each client may send eventBurst events at once, and one more
+	// every eventRefill after that. Further events are dropped.
+	eventBurst  = 5
+	eventRefill = time.Second
+)
+
+// TypingEvent is the data of typing events.
+type TypingEvent struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// typingKey identifies a user typing in a chat.
+type typingKey struct {
+	chatID int64
+	userID int64
+}
+
+// typingState is a user typing in a chat, until expires.
+type typingState struct {
+	username string
+	expires  time.Time
+}
+
+// typingUpdate is a client starting or stopping to type.
+type typingUpdate struct {
+	client   *Client
+	username string
+	typing   bool
+}
+
+// SetTyping records that the client's user started or stopped typing in its chat.
+func (h *Hub) SetTyping(client *Client, typing bool) {
+	h.typingUpdates <- typingUpdate{client: client, username: client.access.User.Username, typing: typing}
+}
+
+// updateTyping applies a typing update, telling the chat's other members when
+// the user starts or stops typing. Repeated starts only extend the timeout.
+func (h *Hub) updateTyping(update typingUpdate) {
+	if _, ok := h.Clients[update.client]; !ok {
+		return
+	}
+	key := typingKey{chatID: update.client.ChatID, userID: update.client.UserID}
+	_, typing := h.typing[key]
+	if !update.typing {
+		if typing {
+			h.stopTyping(key)
+		}
+		return
+	}
+	h.typing[key] = typingState{username: update.username, expires: time.Now().Add(typingTimeout)}
+	if !typing {
+		h.sendTyping(key, EventTypingStart, update.username)
+	}
+}
+
+// stopTyping clears a user's typing state and tells the chat's other members.
+func (h *Hub) stopTyping(key typingKey) {
+	state := h.typing[key]
+	delete(h.typing, key)
+	h.sendTyping(key, EventTypingStop, state.username)
+}
+
+// expireTyping stops the typing of users who have not sent typing.start within typingTimeout.
+func (h *Hub) expireTyping(now time.Time) {
+	for key, state := range h.typing {
+		if now.After(state.expires) {
+			h.stopTyping(key)
+		}
+	}
+}
+
+// clientGone stops the typing of a disconnected client's user, unless they
+// are still connected to the chat elsewhere.
+func (h *Hub) clientGone(client *Client) {
+	key := typingKey{chatID: client.ChatID, userID: client.UserID}
+	if _, ok := h.typing[key]; !ok {
+		return
+	}
+	for other := range h.Clients {
+		if other.ChatID == key.chatID && other.UserID == key.userID {
+			return
+		}
+	}
+	h.stopTyping(key)
+}
+
+// clientsGone calls clientGone for each of the clients.
+func (h *Hub) clientsGone(clients []*Client) {
+	for _, client := range clients {
+		h.clientGone(client)
+	}
+}
+
+// sendTyping sends a typing event to the clients of the chat, except those of
+// the typing user.
+func (h *Hub) sendTyping(key typingKey, eventType, username string) {
+	message, err := json.Marshal(Event{
+		Type:   eventType,
+		ChatID: key.chatID,
+		Data:   TypingEvent{UserID: strconv.FormatInt(key.userID, 10), Username: username},
+	})
+	if err != nil {
+		log.Printf("sendTyping: Error marshalling %s event: %v", eventType, err)
+		return
+	}
+	var dropped []*Client
+	for client := range h.Clients {
+		if client.ChatID == key.chatID && client.UserID != key.userID && !h.deliver(client, message) {
+			dropped = append(dropped, client)
+		}
+	}
+	h.clientsGone(dropped)
+}
+
+// rateLimiter is a token bucket limiting the events sent by a client. It
+// is only used by the client's read pump.
+type rateLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow reports whether another event may be sent now.
+func (l *rateLimiter) allow(now time.Time) bool {
+	if l.last.IsZero() {
+		l.tokens = eventBurst
+	} else {
+		l.tokens += float64(now.Sub(l.last)) / float64(eventRefill)
+		if l.tokens > eventBurst {
+			l.tokens = eventBurst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
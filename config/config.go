@@ -0,0 +1,269 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings. Values are read from environment variables.
+type Config struct {
+	// Addr is the address the HTTP server listens on (ADDR).
+	Addr string
+	// DatabasePath is the SQLite database file (DATABASE_PATH).
+	DatabasePath string
+	// JWTKeysFile points to a JSON file describing the JWT signing keys (JWT_KEYS_FILE).
+	// When empty, tokens are signed with HS256 using JWTSecret.
+	JWTKeysFile string
+	// JWTSecret is the HS256 secret used when no keys file is configured (JWT_SECRET).
+	// One of JWTKeysFile and JWTSecret is required.
+	JWTSecret string
+	// AccessTokenTTL is the lifetime of access JWTs (ACCESS_TOKEN_TTL).
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is the lifetime of each refresh token (REFRESH_TOKEN_TTL).
+	RefreshTokenTTL time.Duration
+	// PasswordResetTTL is how long a password reset token stays valid (PASSWORD_RESET_TTL).
+	PasswordResetTTL time.Duration
+
+	// UnverifiedUserPolicy controls what users with an unverified email may do
+	// (UNVERIFIED_USER_POLICY): UnverifiedDeny blocks login, UnverifiedRestricted
+	// allows login but not creating chats or sending messages.
+	UnverifiedUserPolicy string
+	// EmailVerificationTTL is how long an email verification link stays valid (EMAIL_VERIFICATION_TTL).
+	EmailVerificationTTL time.Duration
+	// VerificationResendInterval is the minimum time between verification emails
+	// to the same address (VERIFICATION_RESEND_INTERVAL).
+	VerificationResendInterval time.Duration
+
+	// TOTPIssuer is the issuer name shown in authenticator apps (TOTP_ISSUER).
+	TOTPIssuer string
+	// MFAChallengeTTL is how long a two-factor login challenge stays valid (MFA_CHALLENGE_TTL).
+	MFAChallengeTTL time.Duration
+
+	// LoginMaxFailures is the number of failed logins for one account before it
+	// is locked (LOGIN_MAX_FAILURES).
+	LoginMaxFailures int
+	// LoginIPMaxFailures is the number of failed logins from one IP address
+	// before it is locked (LOGIN_IP_MAX_FAILURES).
+	LoginIPMaxFailures int
+	// LoginLockoutDuration is the first lockout period; it doubles with each
+	// further failure (LOGIN_LOCKOUT_DURATION).
+	LoginLockoutDuration time.Duration
+	// LoginLockoutMax caps the lockout period (LOGIN_LOCKOUT_MAX).
+	LoginLockoutMax time.Duration
+	// LoginFailureWindow is how long failures are remembered after the last
+	// failed attempt (LOGIN_FAILURE_WINDOW).
+	LoginFailureWindow time.Duration
+
+	// OIDCIssuer enables single sign-on with an OpenID Connect provider (OIDC_ISSUER).
+	OIDCIssuer string
+	// OIDCClientID and OIDCClientSecret are the client credentials registered
+	// at the provider (OIDC_CLIENT_ID, OIDC_CLIENT_SECRET).
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is the callback URL registered at the provider
+	// (OIDC_REDIRECT_URL). It defaults to AppBaseURL + "/user/oidc/callback".
+	OIDCRedirectURL string
+	// OIDCScopes are the space-separated scopes requested from the provider (OIDC_SCOPES).
+	OIDCScopes string
+	// OIDCMFAValues are the space-separated amr or acr values with which the
+	// provider asserts a second factor (OIDC_MFA_VALUES). Users with two-factor
+	// authentication enabled skip their own second factor only when the ID
+	// token carries one of them. Empty trusts no assertion.
+	OIDCMFAValues string
+
+	// MessageEditWindow is how long after sending a message its author may edit
+	// it (MESSAGE_EDIT_WINDOW). Zero allows editing at any time.
+	MessageEditWindow time.Duration
+	// DeletedMessageRetention is how long the content of a deleted message is
+	// kept in the database before it is purged (DELETED_MESSAGE_RETENTION).
+	// Zero purges it as soon as the message is deleted.
+	DeletedMessageRetention time.Duration
+
+	// AppBaseURL is the public URL used to build links in emails (APP_BASE_URL).
+	AppBaseURL string
+	// MailDriver selects how email is delivered: "outbox" or "smtp" (MAIL_DRIVER).
+	MailDriver string
+	// MailFrom is the sender address of outgoing email (MAIL_FROM).
+	MailFrom string
+	// MailOutboxDir is where the outbox driver writes messages (MAIL_OUTBOX_DIR).
+	MailOutboxDir string
+	// SMTPAddr, SMTPUsername and SMTPPassword configure the smtp driver
+	// (SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD).
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// Values of UnverifiedUserPolicy.
+const (
+	UnverifiedDeny       = "deny"
+	UnverifiedRestricted = "restricted"
+)
+
+// C is the active configuration. It holds the defaults until Load is called.
+var C = defaults()
+
+func defaults() *Config {
+	return &Config{
+		Addr:                       ":8080",
+		DatabasePath:               "chatapp.db",
+		AccessTokenTTL:             15 * time.Minute,
+		RefreshTokenTTL:            30 * 24 * time.Hour,
+		PasswordResetTTL:           time.Hour,
+		UnverifiedUserPolicy:       UnverifiedRestricted,
+		EmailVerificationTTL:       24 * time.Hour,
+		VerificationResendInterval: time.Minute,
+		TOTPIssuer:                 "go-messaging",
+		MFAChallengeTTL:            5 * time.Minute,
+		LoginMaxFailures:           5,
+		LoginIPMaxFailures:         20,
+		LoginLockoutDuration:       time.Minute,
+		LoginLockoutMax:            time.Hour,
+		LoginFailureWindow:         24 * time.Hour,
+		OIDCScopes:                 "openid email profile",
+		MessageEditWindow:          15 * time.Minute,
+		AppBaseURL:                 "http://localhost:8080",
+		MailDriver:                 "outbox",
+		MailFrom:                   "no-reply@localhost",
+		MailOutboxDir:              "outbox",
+	}
+}
+
+// Load reads the configuration from the environment, falling back to defaults
+// for unset variables, and assigns it to the package-level C variable.
+func Load() (*Config, error) {
+	cfg := defaults()
+	cfg.Addr = envString("ADDR", cfg.Addr)
+	cfg.DatabasePath = envString("DATABASE_PATH", cfg.DatabasePath)
+	cfg.JWTKeysFile = envString("JWT_KEYS_FILE", cfg.JWTKeysFile)
+	cfg.JWTSecret = envString("JWT_SECRET", cfg.JWTSecret)
+	cfg.UnverifiedUserPolicy = envString("UNVERIFIED_USER_POLICY", cfg.UnverifiedUserPolicy)
+	cfg.TOTPIssuer = envString("TOTP_ISSUER", cfg.TOTPIssuer)
+	cfg.AppBaseURL = envString("APP_BASE_URL", cfg.AppBaseURL)
+	cfg.OIDCIssuer = envString("OIDC_ISSUER", cfg.OIDCIssuer)
+	cfg.OIDCClientID = envString("OIDC_CLIENT_ID", cfg.OIDCClientID)
+	cfg.OIDCClientSecret = envString("OIDC_CLIENT_SECRET", cfg.OIDCClientSecret)
+	cfg.OIDCRedirectURL = envString("OIDC_REDIRECT_URL", strings.TrimSuffix(cfg.AppBaseURL, "/")+"/user/oidc/callback")
+	cfg.OIDCScopes = envString("OIDC_SCOPES", cfg.OIDCScopes)
+	cfg.OIDCMFAValues = envString("OIDC_MFA_VALUES", cfg.OIDCMFAValues)
+	cfg.MailDriver = envString("MAIL_DRIVER", cfg.MailDriver)
+	cfg.MailFrom = envString("MAIL_FROM", cfg.MailFrom)
+	cfg.MailOutboxDir = envString("MAIL_OUTBOX_DIR", cfg.MailOutboxDir)
+	cfg.SMTPAddr = envString("SMTP_ADDR", cfg.SMTPAddr)
+	cfg.SMTPUsername = envString("SMTP_USERNAME", cfg.SMTPUsername)
+	cfg.SMTPPassword = envString("SMTP_PASSWORD", cfg.SMTPPassword)
+
+	var err error
+	if cfg.AccessTokenTTL, err = envDuration("ACCESS_TOKEN_TTL", cfg.AccessTokenTTL); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshTokenTTL, err = envDuration("REFRESH_TOKEN_TTL", cfg.RefreshTokenTTL); err != nil {
+		return nil, err
+	}
+	if cfg.PasswordResetTTL, err = envDuration("PASSWORD_RESET_TTL", cfg.PasswordResetTTL); err != nil {
+		return nil, err
+	}
+	if cfg.EmailVerificationTTL, err = envDuration("EMAIL_VERIFICATION_TTL", cfg.EmailVerificationTTL); err != nil {
+		return nil, err
+	}
+	if cfg.VerificationResendInterval, err = envDuration("VERIFICATION_RESEND_INTERVAL", cfg.VerificationResendInterval); err != nil {
+		return nil, err
+	}
+	if cfg.MFAChallengeTTL, err = envDuration("MFA_CHALLENGE_TTL", cfg.MFAChallengeTTL); err != nil {
+		return nil, err
+	}
+	if cfg.LoginMaxFailures, err = envInt("LOGIN_MAX_FAILURES", cfg.LoginMaxFailures); err != nil {
+		return nil, err
+	}
+	if cfg.LoginIPMaxFailures, err = envInt("LOGIN_IP_MAX_FAILURES", cfg.LoginIPMaxFailures); err != nil {
+		return nil, err
+	}
+	if cfg.LoginLockoutDuration, err = envDuration("LOGIN_LOCKOUT_DURATION", cfg.LoginLockoutDuration); err != nil {
+		return nil, err
+	}
+	if cfg.LoginLockoutMax, err = envDuration("LOGIN_LOCKOUT_MAX", cfg.LoginLockoutMax); err != nil {
+		return nil, err
+	}
+	if cfg.LoginFailureWindow, err = envDuration("LOGIN_FAILURE_WINDOW", cfg.LoginFailureWindow); err != nil {
+		return nil, err
+	}
+
+	if cfg.MessageEditWindow, err = envDuration("MESSAGE_EDIT_WINDOW", cfg.MessageEditWindow); err != nil {
+		return nil, err
+	}
+	if cfg.DeletedMessageRetention, err = envDuration("DELETED_MESSAGE_RETENTION", cfg.DeletedMessageRetention); err != nil {
+		return nil, err
+	}
+
+	if cfg.JWTKeysFile == "" && cfg.JWTSecret == "" {
+		return nil, fmt.Errorf("JWT_SECRET or JWT_KEYS_FILE is required")
+	}
+
+	if cfg.UnverifiedUserPolicy != UnverifiedDeny && cfg.UnverifiedUserPolicy != UnverifiedRestricted {
+		return nil, fmt.Errorf("invalid UNVERIFIED_USER_POLICY %q", cfg.UnverifiedUserPolicy)
+	}
+
+	if cfg.LoginMaxFailures < 1 || cfg.LoginIPMaxFailures < 1 {
+		return nil, fmt.Errorf("LOGIN_MAX_FAILURES and LOGIN_IP_MAX_FAILURES must be at least 1")
+	}
+
+	if cfg.MessageEditWindow < 0 || cfg.DeletedMessageRetention < 0 {
+		return nil, fmt.Errorf("MESSAGE_EDIT_WINDOW and DELETED_MESSAGE_RETENTION must not be negative")
+	}
+
+	if cfg.OIDCIssuer != "" && cfg.OIDCClientID == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+
+	switch cfg.MailDriver {
+	case "outbox":
+	case "smtp":
+		if cfg.SMTPAddr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR is required when MAIL_DRIVER is smtp")
+		}
+	default:
+		return nil, fmt.Errorf("invalid MAIL_DRIVER %q", cfg.MailDriver)
+	}
+
+	C = cfg
+	return cfg, nil
+}
+
+// OIDCEnabled reports whether single sign-on with an OpenID Connect provider is configured.
+func (c *Config) OIDCEnabled() bool {
+	return c.OIDCIssuer != ""
+}
+
+func envString(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import "testing"
+
+func TestLoadRequiresJWTKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		keysFile string
+		wantErr  bool
+	}{
+		{name: "neither", wantErr: true},
+		{name: "secret", secret: "s3cret"},
+		{name: "keys file", keysFile: "keys.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", tt.secret)
+			t.Setenv("JWT_KEYS_FILE", tt.keysFile)
+			_, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrAPIKeyNotFound is returned when an API key does not exist, belongs to another user or was revoked.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// apiKeyTouchInterval limits how often last_used_at is written for a busy key.
+const apiKeyTouchInterval = time.Minute
+
+// APIKey represents a row in the api_keys table. Only the hash of the key is stored.
+type APIKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+}
+
+const apiKeyColumns = "id, user_id, name, key_prefix, scopes, created_at, last_used_at, expires_at"
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt); err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	return &key, nil
+}
+
+// InsertAPIKey stores a new API key under the hash of its value.
+func InsertAPIKey(key APIKey, keyHash string) error {
+	query := "INSERT INTO api_keys (id, user_id, name, key_prefix, key_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	if _, err := DB.Exec(query, key.ID, key.UserID, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, " "), key.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+	return nil
+}
+
+// GetUserAPIKeys returns the user's API keys that have not been revoked, newest first.
+// Expired keys are included so they can be rotated or revoked.
+func GetUserAPIKeys(userID string) ([]*APIKey, error) {
+	rows, err := DB.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// GetUserAPIKey returns one of the user's API keys that has not been revoked.
+func GetUserAPIKey(userID, keyID string) (*APIKey, error) {
+	row := DB.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	return key, nil
+}
+
+// GetActiveAPIKey returns the API key with the given hash if it is neither
+// revoked nor expired, and records that it was used.
+func GetActiveAPIKey(keyHash string) (*APIKey, error) {
+	row := DB.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL", keyHash)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenInactive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	now := time.Now()
+	if key.ExpiresAt.Valid && !now.Before(key.ExpiresAt.Time) {
+		return nil, ErrTokenInactive
+	}
+	if !key.LastUsedAt.Valid || now.Sub(key.LastUsedAt.Time) >= apiKeyTouchInterval {
+		if _, err := DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now, key.ID); err != nil {
+			return nil, fmt.Errorf("failed to update API key: %w", err)
+		}
+		key.LastUsedAt = sql.NullTime{Time: now, Valid: true}
+	}
+	return key, nil
+}
+
+// RotateAPIKey replaces the secret of one of the user's API keys. The old value stops working immediately.
+func RotateAPIKey(userID, keyID, prefix, keyHash string) error {
+	res, err := DB.Exec("UPDATE api_keys SET key_prefix = ?, key_hash = ?, last_used_at = NULL WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		prefix, keyHash, keyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to rotate API key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to rotate API key: %w", err)
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// RevokeAPIKey revokes one of the user's API keys.
+func RevokeAPIKey(userID, keyID string) error {
+	res, err := DB.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", time.Now(), keyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// InsertServiceAccount creates a user that cannot log in with a password and
+// authenticates with API keys only.
+func InsertServiceAccount(username, email string) (*User, error) {
+	if username == "" || email == "" {
+		return nil, fmt.Errorf("username and email must not be empty")
+	}
+	query := "INSERT INTO users (username, email, password, email_verified_at, is_service_account) VALUES (?, ?, '', ?, 1)"
+	result, err := DB.Exec(query, username, email, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert service account: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last inserted ID: %w", err)
+	}
+	return &User{
+		ID:               strconv.FormatInt(id, 10),
+		Username:         username,
+		Email:            email,
+		EmailVerified:    true,
+		IsServiceAccount: true,
+	}, nil
+}
+
+// GetServiceAccounts returns every service account.
+func GetServiceAccounts() ([]*User, error) {
+	rows, err := DB.Query("SELECT " + userColumns + " FROM users WHERE is_service_account = 1 ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan service account: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query service accounts: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,622 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Roles of chat members.
+const (
+	ChatRoleOwner  = "owner"
+	ChatRoleAdmin  = "admin"
+	ChatRoleMember = "member"
+)
+
+// ErrUserNotFound is returned when a referenced user does not exist.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrChatNotFound is returned when a chat does not exist.
+var ErrChatNotFound = errors.New("chat not found")
+
+// ErrNotChatMember is returned when a user is not a member of a chat.
+var ErrNotChatMember = errors.New("not a member of this chat")
+
+// ErrAlreadyChatMember is returned when adding a user who is already a member of the chat.
+var ErrAlreadyChatMember = errors.New("user is already a member of this chat")
+
+// ErrChatPermissionDenied is returned when the acting member's role does not allow the change.
+var ErrChatPermissionDenied = errors.New("your role in this chat does not allow this change")
+
+// ErrOwnerMustTransfer is returned when the owner leaves a chat that still has other members.
+var ErrOwnerMustTransfer = errors.New("transfer ownership before leaving the chat")
+
+// ErrChatArchived is returned when sending a message to, or archiving, an archived chat.
+var ErrChatArchived = errors.New("chat is archived")
+
+// ErrChatNotArchived is returned when unarchiving a chat that is not archived.
+var ErrChatNotArchived = errors.New("chat is not archived")
+
+type Chat struct {
+	ID          string
+	Title       string
+	Description string
+	AvatarURL   string
+	UserIDs     []string
+	Members     []ChatMember
+	IsGroup     bool
+	ArchivedAt  sql.NullTime
+}
+
+// ChatUpdate lists the chat details to change. Nil fields are left unchanged.
+type ChatUpdate struct {
+	Title       *string
+	Description *string
+	AvatarURL   *string
+}
+
+// chatColumns lists the chats columns read by scanChat, in order.
+const chatColumns = "c.id, c.title, c.description, c.avatar_url, c.is_group, c.archived_at"
+
+func scanChat(row rowScanner) (*Chat, error) {
+	var chat Chat
+	if err := row.Scan(&chat.ID, &chat.Title, &chat.Description, &chat.AvatarURL, &chat.IsGroup, &chat.ArchivedAt); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// ChatMember represents a row in the chat_members table.
+type ChatMember struct {
+	UserID   string
+	Username string
+	Role     string
+	JoinedAt time.Time
+	// LastReadMessageID is the latest message the member has read.
+	LastReadMessageID int64
+}
+
+// InsertChat creates a chat owned by ownerID with the given other members.
+// Every member must be an existing user.
+func InsertChat(title, ownerID string, memberIDs []string, isGroup bool) (*Chat, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO chats (title, is_group) VALUES (?, ?)", title, isGroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert chat: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last inserted ID: %w", err)
+	}
+
+	chat := &Chat{
+		ID:      strconv.FormatInt(id, 10),
+		Title:   title,
+		IsGroup: isGroup,
+	}
+	now := time.Now()
+	addMember := func(userID, role string) error {
+		for _, member := range chat.Members {
+			if member.UserID == userID {
+				return nil
+			}
+		}
+		var username string
+		err := tx.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up user: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO chat_members (chat_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)", id, userID, role, now); err != nil {
+			return fmt.Errorf("failed to insert chat member: %w", err)
+		}
+		chat.Members = append(chat.Members, ChatMember{UserID: userID, Username: username, Role: role, JoinedAt: now})
+		chat.UserIDs = append(chat.UserIDs, userID)
+		return nil
+	}
+
+	if err := addMember(ownerID, ChatRoleOwner); err != nil {
+		return nil, err
+	}
+	for _, userID := range memberIDs {
+		if err := addMember(userID, ChatRoleMember); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to insert chat: %w", err)
+	}
+	return chat, nil
+}
+
+// GetOrCreateDirectChat returns the one-to-one chat between the two users,
+// creating it if it does not exist yet. Either user who left the chat is added
+// back. The returned flag reports whether the chat was created.
+func GetOrCreateDirectChat(userID, otherID string) (*Chat, bool, error) {
+	key, err := directChatKey(userID, otherID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Inserting first takes the write lock, so concurrent requests for the same pair cannot both create a chat.
+	res, err := tx.Exec("INSERT INTO chats (title, is_group, dm_key) VALUES ('', 0, ?) ON CONFLICT(dm_key) DO NOTHING", key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to insert chat: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to insert chat: %w", err)
+	}
+	created := n > 0
+
+	var chatID string
+	if err := tx.QueryRow("SELECT id FROM chats WHERE dm_key = ?", key).Scan(&chatID); err != nil {
+		return nil, false, fmt.Errorf("failed to look up chat: %w", err)
+	}
+	now := time.Now()
+	for _, id := range []string{userID, otherID} {
+		_, err := tx.Exec(`INSERT INTO chat_members (chat_id, user_id, role, joined_at, last_read_message_id)
+			VALUES (?, ?, ?, ?, `+latestMessageID+`)
+			ON CONFLICT(chat_id, user_id) DO NOTHING`, chatID, id, ChatRoleMember, now, chatID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to insert chat member: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to insert chat: %w", err)
+	}
+
+	chat, err := GetChatByID(chatID)
+	if err != nil {
+		return nil, false, err
+	}
+	return chat, created, nil
+}
+
+// directChatKey identifies the one-to-one chat between two users regardless of their order.
+func directChatKey(userID, otherID string) (string, error) {
+	a, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid user ID %q: %w", userID, err)
+	}
+	b, err := strconv.ParseInt(otherID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid user ID %q: %w", otherID, err)
+	}
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d:%d", a, b), nil
+}
+
+// GetChatByID retrieves a chat and its members.
+func GetChatByID(id string) (*Chat, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	chat, err := scanChat(tx.QueryRow("SELECT "+chatColumns+" FROM chats c WHERE c.id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := queryChatMembers(tx, `SELECT m.chat_id, m.user_id, u.username, m.role, m.joined_at, m.last_read_message_id FROM chat_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.chat_id = ? ORDER BY m.joined_at, m.rowid`, id)
+	if err != nil {
+		return nil, err
+	}
+	chat.setMembers(members[chat.ID])
+	return chat, tx.Commit()
+}
+
+// GetChatsByUserID retrieves all chats where the specified user is a participant.
+// Archived chats are left out unless includeArchived is set.
+func GetChatsByUserID(userID string, includeArchived bool) ([]*Chat, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + chatColumns + ` FROM chat_members m
+		JOIN chats c ON c.id = m.chat_id
+		WHERE m.user_id = ? AND (? OR c.archived_at IS NULL) ORDER BY c.id`
+	rows, err := tx.Query(query, userID, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	var chats []*Chat
+	for rows.Next() {
+		chat, err := scanChat(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := queryChatMembers(tx, `SELECT m.chat_id, m.user_id, u.username, m.role, m.joined_at, m.last_read_message_id FROM chat_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.chat_id IN (SELECT chat_id FROM chat_members WHERE user_id = ?)
+		ORDER BY m.chat_id, m.joined_at, m.rowid`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, chat := range chats {
+		chat.setMembers(members[chat.ID])
+	}
+	return chats, tx.Commit()
+}
+
+// GetChatMember returns the user's membership of the chat. It returns
+// ErrChatNotFound if the chat does not exist and ErrNotChatMember if the user
+// is not a member.
+func GetChatMember(chatID, userID string) (*ChatMember, error) {
+	query := `SELECT m.user_id, u.username, m.role, m.joined_at, m.last_read_message_id FROM chats c
+		LEFT JOIN chat_members m ON m.chat_id = c.id AND m.user_id = ?
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE c.id = ?`
+	var memberID, username, role sql.NullString
+	var joinedAt sql.NullTime
+	var lastRead sql.NullInt64
+	err := DB.QueryRow(query, userID, chatID).Scan(&memberID, &username, &role, &joinedAt, &lastRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChatNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up chat member: %w", err)
+	}
+	if !memberID.Valid {
+		return nil, ErrNotChatMember
+	}
+	return &ChatMember{UserID: memberID.String, Username: username.String, Role: role.String, JoinedAt: joinedAt.Time,
+		LastReadMessageID: lastRead.Int64}, nil
+}
+
+// AddChatMembers adds users to the chat as members and records the change as a
+// system message. The actor must be an owner or admin of the chat when the
+// change is written, and every user must exist and must not be a member yet.
+func AddChatMembers(chatID, actorID string, userIDs []string, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := requireChatManager(tx, chatID, actorID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		res, err := tx.Exec(`INSERT INTO chat_members (chat_id, user_id, role, joined_at, last_read_message_id)
+			SELECT ?, id, ?, ?, `+latestMessageID+` FROM users WHERE id = ?
+			ON CONFLICT(chat_id, user_id) DO NOTHING`, chatID, ChatRoleMember, now, chatID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to insert chat member: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to insert chat member: %w", err)
+		} else if n == 0 {
+			var exists bool
+			if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists); err != nil {
+				return fmt.Errorf("failed to look up user: %w", err)
+			}
+			if exists {
+				return fmt.Errorf("%w: %s", ErrAlreadyChatMember, userID)
+			}
+			return fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+		}
+	}
+	return commitChatEvent(tx, event)
+}
+
+// RemoveChatMember removes the user from the chat and records the change as a
+// system message. When the change is written, the actor must be the owner, or
+// an admin removing a member.
+func RemoveChatMember(chatID, actorID, userID string, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actorRole, err := chatMemberRole(tx, chatID, actorID)
+	if errors.Is(err, ErrNotChatMember) {
+		return ErrChatPermissionDenied
+	}
+	if err != nil {
+		return err
+	}
+	targetRole, err := chatMemberRole(tx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case targetRole == ChatRoleOwner:
+		return ErrChatPermissionDenied
+	case actorRole == ChatRoleOwner:
+	case actorRole == ChatRoleAdmin && targetRole == ChatRoleMember:
+	default:
+		return ErrChatPermissionDenied
+	}
+
+	res, err := tx.Exec("DELETE FROM chat_members WHERE chat_id = ? AND user_id = ?", chatID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove chat member: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrNotChatMember); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, event)
+}
+
+// LeaveChat removes the user from the chat and records the change as a system
+// message. The owner can only leave as the last member; this is checked when
+// the change is written, so that concurrent changes cannot leave the chat without an owner.
+func LeaveChat(chatID, userID string, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	role, err := chatMemberRole(tx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if role == ChatRoleOwner {
+		var others bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM chat_members WHERE chat_id = ? AND user_id != ?)", chatID, userID).Scan(&others)
+		if err != nil {
+			return fmt.Errorf("failed to look up chat members: %w", err)
+		}
+		if others {
+			return ErrOwnerMustTransfer
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM chat_members WHERE chat_id = ? AND user_id = ?", chatID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove chat member: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrNotChatMember); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, event)
+}
+
+// SetChatMemberRole changes the role of a chat member other than the owner and
+// records the change as a system message. The actor must be the owner when the
+// change is written.
+func SetChatMemberRole(chatID, actorID, userID, role string, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actorRole, err := chatMemberRole(tx, chatID, actorID)
+	if err != nil && !errors.Is(err, ErrNotChatMember) {
+		return err
+	}
+	if actorRole != ChatRoleOwner {
+		return ErrChatPermissionDenied
+	}
+
+	res, err := tx.Exec("UPDATE chat_members SET role = ? WHERE chat_id = ? AND user_id = ? AND role != ?",
+		role, chatID, userID, ChatRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to update chat member: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrNotChatMember); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, event)
+}
+
+// TransferChatOwnership makes newOwnerID the owner of the chat and demotes the
+// current owner to admin, recording the change as a system message.
+func TransferChatOwnership(chatID, ownerID, newOwnerID string, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE chat_members SET role = ? WHERE chat_id = ? AND user_id = ? AND role = ?",
+		ChatRoleAdmin, chatID, ownerID, ChatRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to update chat member: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrNotChatMember); err != nil {
+		return err
+	}
+	res, err = tx.Exec("UPDATE chat_members SET role = ? WHERE chat_id = ? AND user_id = ?", ChatRoleOwner, chatID, newOwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to update chat member: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrNotChatMember); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, event)
+}
+
+// UpdateChat changes the chat's details and records the change as a system message.
+func UpdateChat(chatID string, update ChatUpdate, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE chats SET title = COALESCE(?, title), description = COALESCE(?, description),
+		avatar_url = COALESCE(?, avatar_url) WHERE id = ?`, update.Title, update.Description, update.AvatarURL, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to update chat: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrChatNotFound); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, event)
+}
+
+// SetChatArchived archives or unarchives the chat and records the change as a
+// system message. It returns ErrChatArchived or ErrChatNotArchived if the chat
+// is already in the requested state.
+func SetChatArchived(chatID string, archived bool, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var res sql.Result
+	conflict := ErrChatNotArchived
+	if archived {
+		res, err = tx.Exec("UPDATE chats SET archived_at = ? WHERE id = ? AND archived_at IS NULL", time.Now(), chatID)
+		conflict = ErrChatArchived
+	} else {
+		res, err = tx.Exec("UPDATE chats SET archived_at = NULL WHERE id = ? AND archived_at IS NOT NULL", chatID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update chat: %w", err)
+	}
+	if err := requireRowsAffected(res, conflict); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, event)
+}
+
+// DeleteChat permanently deletes the chat together with its members, invites and messages,
+// including message revisions, reactions and mentions.
+func DeleteChat(chatID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"chat_invite_uses", "chat_invites", "message_mentions", "message_reactions", "message_hidden", "message_revisions", "messages", "chat_members"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE chat_id = ?", chatID); err != nil {
+			return fmt.Errorf("failed to delete chat %s: %w", table, err)
+		}
+	}
+	res, err := tx.Exec("DELETE FROM chats WHERE id = ?", chatID)
+	if err != nil {
+		return fmt.Errorf("failed to delete chat: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrChatNotFound); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete chat: %w", err)
+	}
+	return nil
+}
+
+// requireChatManager returns ErrChatPermissionDenied unless the user is an owner or admin of the chat.
+func requireChatManager(tx *sql.Tx, chatID, userID string) error {
+	role, err := chatMemberRole(tx, chatID, userID)
+	if err != nil && !errors.Is(err, ErrNotChatMember) {
+		return err
+	}
+	if role != ChatRoleOwner && role != ChatRoleAdmin {
+		return ErrChatPermissionDenied
+	}
+	return nil
+}
+
+// chatMemberRole returns the user's role in the chat, or ErrNotChatMember.
+func chatMemberRole(tx *sql.Tx, chatID, userID string) (string, error) {
+	var role string
+	err := tx.QueryRow("SELECT role FROM chat_members WHERE chat_id = ? AND user_id = ?", chatID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotChatMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up chat member: %w", err)
+	}
+	return role, nil
+}
+
+// commitChatEvent inserts the system message describing a change, if any, and commits the transaction.
+func commitChatEvent(tx *sql.Tx, event *Message) error {
+	if event != nil {
+		event.Kind = MessageKindSystem
+		if err := insertMessage(tx, event); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit chat change: %w", err)
+	}
+	return nil
+}
+
+// requireRowsAffected returns notFound if the statement changed no rows.
+func requireRowsAffected(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// queryChatMembers runs a query selecting chat_id, user_id, username, role and joined_at
+// and groups the members by chat ID.
+func queryChatMembers(tx *sql.Tx, query string, args ...interface{}) (map[string][]ChatMember, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make(map[string][]ChatMember)
+	for rows.Next() {
+		var chatID string
+		var member ChatMember
+		if err := rows.Scan(&chatID, &member.UserID, &member.Username, &member.Role, &member.JoinedAt, &member.LastReadMessageID); err != nil {
+			return nil, fmt.Errorf("failed to scan chat member: %w", err)
+		}
+		members[chatID] = append(members[chatID], member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query chat members: %w", err)
+	}
+	return members, nil
+}
+
+func (c *Chat) setMembers(members []ChatMember) {
+	c.Members = members
+	c.UserIDs = make([]string, 0, len(members))
+	for _, member := range members {
+		c.UserIDs = append(c.UserIDs, member.UserID)
+	}
+}
@@ -0,0 +1,351 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Statuses of chat invite uses. A use is recorded as joined when the invite
+// admits the user directly, and as pending until an admin approves or rejects it otherwise.
+const (
+	InviteUseJoined   = "joined"
+	InviteUsePending  = "pending"
+	InviteUseApproved = "approved"
+	InviteUseRejected = "rejected"
+)
+
+// ErrInviteNotFound is returned when an invite does not exist or can no longer
+// be used because it was revoked, has expired or has no uses left.
+var ErrInviteNotFound = errors.New("invite not found or no longer valid")
+
+// ErrJoinRequestNotFound is returned when a join request does not exist or was already decided.
+var ErrJoinRequestNotFound = errors.New("join request not found")
+
+// ErrJoinRequestPending is returned when the user already has a pending request to join the chat.
+var ErrJoinRequestPending = errors.New("a request to join this chat is already pending")
+
+// ChatInvite represents a row in the chat_invites table. Only the hash of the code is stored.
+type ChatInvite struct {
+	ID               string
+	ChatID           string
+	Prefix           string
+	CreatedBy        string
+	CreatedAt        time.Time
+	ExpiresAt        sql.NullTime
+	MaxUses          sql.NullInt64
+	Uses             int64
+	RequiresApproval bool
+}
+
+// Active reports whether the invite can still be used at the given time.
+func (i *ChatInvite) Active(now time.Time) bool {
+	if i.ExpiresAt.Valid && !now.Before(i.ExpiresAt.Time) {
+		return false
+	}
+	return !i.MaxUses.Valid || i.Uses < i.MaxUses.Int64
+}
+
+// ChatInviteUse represents a row in the chat_invite_uses table.
+type ChatInviteUse struct {
+	ID        string
+	InviteID  string
+	ChatID    string
+	UserID    string
+	Username  string
+	Status    string
+	CreatedAt time.Time
+	DecidedBy sql.NullString
+	DecidedAt sql.NullTime
+}
+
+const chatInviteColumns = "id, chat_id, code_prefix, created_by, created_at, expires_at, max_uses, uses, requires_approval"
+
+func scanChatInvite(row rowScanner) (*ChatInvite, error) {
+	var invite ChatInvite
+	err := row.Scan(&invite.ID, &invite.ChatID, &invite.Prefix, &invite.CreatedBy, &invite.CreatedAt,
+		&invite.ExpiresAt, &invite.MaxUses, &invite.Uses, &invite.RequiresApproval)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+const chatInviteUseQuery = `SELECT i.id, i.invite_id, i.chat_id, i.user_id, u.username, i.status, i.created_at, i.decided_by, i.decided_at
+	FROM chat_invite_uses i JOIN users u ON u.id = i.user_id`
+
+func scanChatInviteUse(row rowScanner) (*ChatInviteUse, error) {
+	var use ChatInviteUse
+	err := row.Scan(&use.ID, &use.InviteID, &use.ChatID, &use.UserID, &use.Username, &use.Status,
+		&use.CreatedAt, &use.DecidedBy, &use.DecidedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &use, nil
+}
+
+// InsertChatInvite stores a new invite under the hash of its code. The expiry
+// is stored in UTC so that it can be compared in queries.
+func InsertChatInvite(invite ChatInvite, codeHash string) (*ChatInvite, error) {
+	invite.CreatedAt = time.Now()
+	if invite.ExpiresAt.Valid {
+		invite.ExpiresAt.Time = invite.ExpiresAt.Time.UTC()
+	}
+	query := `INSERT INTO chat_invites (chat_id, code_prefix, code_hash, created_by, created_at, expires_at, max_uses, requires_approval)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := DB.Exec(query, invite.ChatID, invite.Prefix, codeHash, invite.CreatedBy, invite.CreatedAt,
+		invite.ExpiresAt, invite.MaxUses, invite.RequiresApproval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert chat invite: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last inserted ID: %w", err)
+	}
+	invite.ID = strconv.FormatInt(id, 10)
+	return &invite, nil
+}
+
+// GetChatInvites returns the chat's invites that have not been revoked, newest first.
+func GetChatInvites(chatID string) ([]*ChatInvite, error) {
+	rows, err := DB.Query("SELECT "+chatInviteColumns+" FROM chat_invites WHERE chat_id = ? AND revoked_at IS NULL ORDER BY id DESC", chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []*ChatInvite
+	for rows.Next() {
+		invite, err := scanChatInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query chat invites: %w", err)
+	}
+	return invites, nil
+}
+
+// GetChatInvite returns one of the chat's invites, including revoked ones.
+func GetChatInvite(chatID, inviteID string) (*ChatInvite, error) {
+	row := DB.QueryRow("SELECT "+chatInviteColumns+" FROM chat_invites WHERE id = ? AND chat_id = ?", inviteID, chatID)
+	invite, err := scanChatInvite(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up chat invite: %w", err)
+	}
+	return invite, nil
+}
+
+// GetActiveChatInvite returns the invite with the given code hash. It returns
+// ErrInviteNotFound if the invite was revoked, has expired or has no uses left.
+func GetActiveChatInvite(codeHash string) (*ChatInvite, error) {
+	row := DB.QueryRow("SELECT "+chatInviteColumns+" FROM chat_invites WHERE code_hash = ? AND revoked_at IS NULL", codeHash)
+	invite, err := scanChatInvite(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up chat invite: %w", err)
+	}
+	if !invite.Active(time.Now()) {
+		return nil, ErrInviteNotFound
+	}
+	return invite, nil
+}
+
+// RevokeChatInvite revokes one of the chat's invites. Pending join requests
+// made with it can no longer be approved.
+func RevokeChatInvite(chatID, inviteID string) error {
+	res, err := DB.Exec("UPDATE chat_invites SET revoked_at = ? WHERE id = ? AND chat_id = ? AND revoked_at IS NULL", time.Now(), inviteID, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke chat invite: %w", err)
+	}
+	return requireRowsAffected(res, ErrInviteNotFound)
+}
+
+// GetChatInviteUses returns every recorded use of the invite, oldest first.
+func GetChatInviteUses(inviteID string) ([]*ChatInviteUse, error) {
+	return queryChatInviteUses(chatInviteUseQuery+" WHERE i.invite_id = ? ORDER BY i.id", inviteID)
+}
+
+// GetPendingJoinRequests returns the chat's join requests awaiting a decision, oldest first.
+func GetPendingJoinRequests(chatID string) ([]*ChatInviteUse, error) {
+	return queryChatInviteUses(chatInviteUseQuery+" WHERE i.chat_id = ? AND i.status = ? ORDER BY i.id", chatID, InviteUsePending)
+}
+
+// GetPendingJoinRequest returns one of the chat's join requests awaiting a decision.
+func GetPendingJoinRequest(chatID, requestID string) (*ChatInviteUse, error) {
+	row := DB.QueryRow(chatInviteUseQuery+" WHERE i.id = ? AND i.chat_id = ? AND i.status = ?", requestID, chatID, InviteUsePending)
+	use, err := scanChatInviteUse(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up join request: %w", err)
+	}
+	return use, nil
+}
+
+// JoinChatWithInvite adds the user to the invite's chat as a member, counts
+// the use and records it, together with the system message describing the join.
+func JoinChatWithInvite(invite *ChatInvite, userID string, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := claimChatInviteUse(tx, invite.ID); err != nil {
+		return err
+	}
+	if err := insertInvitedMember(tx, invite.ChatID, userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO chat_invite_uses (invite_id, chat_id, user_id, status, created_at) VALUES (?, ?, ?, ?, ?)",
+		invite.ID, invite.ChatID, userID, InviteUseJoined, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record chat invite use: %w", err)
+	}
+	return commitChatEvent(tx, event)
+}
+
+// RequestToJoinChat records a pending request to join the invite's chat.
+func RequestToJoinChat(invite *ChatInvite, userID string) (*ChatInviteUse, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var member, pending bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM chat_members WHERE chat_id = ? AND user_id = ?),
+		EXISTS (SELECT 1 FROM chat_invite_uses WHERE chat_id = ? AND user_id = ? AND status = ?)`,
+		invite.ChatID, userID, invite.ChatID, userID, InviteUsePending).Scan(&member, &pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up chat member: %w", err)
+	}
+	if member {
+		return nil, ErrAlreadyChatMember
+	}
+	if pending {
+		return nil, ErrJoinRequestPending
+	}
+
+	use := &ChatInviteUse{InviteID: invite.ID, ChatID: invite.ChatID, UserID: userID, Status: InviteUsePending, CreatedAt: time.Now()}
+	res, err := tx.Exec("INSERT INTO chat_invite_uses (invite_id, chat_id, user_id, status, created_at) VALUES (?, ?, ?, ?, ?)",
+		use.InviteID, use.ChatID, use.UserID, use.Status, use.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert join request: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last inserted ID: %w", err)
+	}
+	use.ID = strconv.FormatInt(id, 10)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to insert join request: %w", err)
+	}
+	return use, nil
+}
+
+// ApproveJoinRequest adds the requesting user to the chat, counts the use of
+// the invite and records the decision, together with the system message
+// describing the join. The invite must not be revoked or expired and must have uses left.
+func ApproveJoinRequest(request *ChatInviteUse, deciderID string, event *Message) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := decideJoinRequest(tx, request, InviteUseApproved, deciderID); err != nil {
+		return err
+	}
+	if err := claimChatInviteUse(tx, request.InviteID); err != nil {
+		return err
+	}
+	if err := insertInvitedMember(tx, request.ChatID, request.UserID); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, event)
+}
+
+// RejectJoinRequest records that the join request was rejected.
+func RejectJoinRequest(request *ChatInviteUse, deciderID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := decideJoinRequest(tx, request, InviteUseRejected, deciderID); err != nil {
+		return err
+	}
+	return commitChatEvent(tx, nil)
+}
+
+// claimChatInviteUse counts one use of the invite, failing with
+// ErrInviteNotFound if it was revoked, has expired or has no uses left.
+func claimChatInviteUse(tx *sql.Tx, inviteID string) error {
+	res, err := tx.Exec(`UPDATE chat_invites SET uses = uses + 1
+		WHERE id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+		AND (max_uses IS NULL OR uses < max_uses)`, inviteID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to update chat invite: %w", err)
+	}
+	return requireRowsAffected(res, ErrInviteNotFound)
+}
+
+func insertInvitedMember(tx *sql.Tx, chatID, userID string) error {
+	res, err := tx.Exec(`INSERT INTO chat_members (chat_id, user_id, role, joined_at, last_read_message_id)
+		VALUES (?, ?, ?, ?, `+latestMessageID+`)
+		ON CONFLICT(chat_id, user_id) DO NOTHING`, chatID, userID, ChatRoleMember, time.Now(), chatID)
+	if err != nil {
+		return fmt.Errorf("failed to insert chat member: %w", err)
+	}
+	return requireRowsAffected(res, ErrAlreadyChatMember)
+}
+
+func decideJoinRequest(tx *sql.Tx, request *ChatInviteUse, status, deciderID string) error {
+	now := time.Now()
+	res, err := tx.Exec("UPDATE chat_invite_uses SET status = ?, decided_by = ?, decided_at = ? WHERE id = ? AND status = ?",
+		status, deciderID, now, request.ID, InviteUsePending)
+	if err != nil {
+		return fmt.Errorf("failed to update join request: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrJoinRequestNotFound); err != nil {
+		return err
+	}
+	request.Status = status
+	request.DecidedBy = sql.NullString{String: deciderID, Valid: true}
+	request.DecidedAt = sql.NullTime{Time: now, Valid: true}
+	return nil
+}
+
+func queryChatInviteUses(query string, args ...interface{}) ([]*ChatInviteUse, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat invite uses: %w", err)
+	}
+	defer rows.Close()
+
+	var uses []*ChatInviteUse
+	for rows.Next() {
+		use, err := scanChatInviteUse(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat invite use: %w", err)
+		}
+		uses = append(uses, use)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query chat invite uses: %w", err)
+	}
+	return uses, nil
+}
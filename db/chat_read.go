@@ -0,0 +1,183 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// latestMessageID selects the ID of the latest message in the chat whose ID is
+// the next argument, or 0 if it has none. New members start with it read.
+const latestMessageID = "(SELECT COALESCE(MAX(id), 0) FROM messages WHERE chat_id = ?)"
+
+// ReadReceipt records that a user has read a chat up to a message.
+type ReadReceipt struct {
+	ChatID    int64
+	MessageID int64
+}
+
+// UnreadState describes what a member has not read in a chat yet.
+type UnreadState struct {
+	// Count is the number of unread messages from other members.
+	Count int
+	// Mentioned reports whether any unread message mentions the member.
+	Mentioned bool
+}
+
+// GetLatestMessageID returns the ID of the latest message in the chat, or 0 if it has none.
+func GetLatestMessageID(chatID string) (int64, error) {
+	var id int64
+	if err := DB.QueryRow("SELECT "+latestMessageID, chatID).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get latest message: %w", err)
+	}
+	return id, nil
+}
+
+// MarkChatRead moves the member's read pointer forward to messageID. It returns
+// the pointer afterwards and whether it moved; it never moves backwards.
+func MarkChatRead(chatID, userID string, messageID int64) (int64, bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE chat_members SET last_read_message_id = ?
+		WHERE chat_id = ? AND user_id = ? AND last_read_message_id < ?`, messageID, chatID, userID, messageID)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to mark chat read: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	var lastRead int64
+	err = tx.QueryRow("SELECT last_read_message_id FROM chat_members WHERE chat_id = ? AND user_id = ?", chatID, userID).Scan(&lastRead)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read chat read state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to mark chat read: %w", err)
+	}
+	return lastRead, n > 0, nil
+}
+
+// MarkAllChatsRead moves the user's read pointer to the latest message in
+// every chat they belong to, and returns the chats where it moved.
+func MarkAllChatsRead(userID string) ([]ReadReceipt, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT chat_id, latest FROM (
+			SELECT m.chat_id, m.last_read_message_id, (SELECT COALESCE(MAX(id), 0) FROM messages WHERE chat_id = m.chat_id) AS latest
+			FROM chat_members m WHERE m.user_id = ?
+		) WHERE latest > last_read_message_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat read state: %w", err)
+	}
+	var receipts []ReadReceipt
+	for rows.Next() {
+		var receipt ReadReceipt
+		if err := rows.Scan(&receipt.ChatID, &receipt.MessageID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan chat read state: %w", err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query chat read state: %w", err)
+	}
+
+	for _, receipt := range receipts {
+		_, err := tx.Exec(`UPDATE chat_members SET last_read_message_id = ?
+			WHERE chat_id = ? AND user_id = ? AND last_read_message_id < ?`, receipt.MessageID, receipt.ChatID, userID, receipt.MessageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark chat read: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to mark chats read: %w", err)
+	}
+	return receipts, nil
+}
+
+// GetUnreadStates returns what the user has not read in each of their chats,
+// keyed by chat ID. Deleted messages, system messages and messages the user
+// has hidden are neither counted nor reported as mentions.
+func GetUnreadStates(userID string) (map[string]UnreadState, error) {
+	rows, err := DB.Query(`SELECT m.chat_id,
+			(SELECT COUNT(*) FROM messages msg
+				WHERE msg.chat_id = m.chat_id AND msg.id > m.last_read_message_id AND msg.user_id != m.user_id
+				AND msg.kind = ? AND msg.deleted_at IS NULL
+				AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = msg.id AND h.user_id = m.user_id)),
+			EXISTS (SELECT 1 FROM message_mentions mm JOIN messages msg ON msg.id = mm.message_id
+				WHERE mm.user_id = m.user_id AND mm.chat_id = m.chat_id AND mm.message_id > m.last_read_message_id
+				AND msg.kind = ? AND msg.deleted_at IS NULL
+				AND NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = msg.id AND h.user_id = m.user_id))
+		FROM chat_members m WHERE m.user_id = ?`, MessageKindUser, MessageKindUser, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unread messages: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]UnreadState)
+	for rows.Next() {
+		var chatID string
+		var state UnreadState
+		if err := rows.Scan(&chatID, &state.Count, &state.Mentioned); err != nil {
+			return nil, fmt.Errorf("failed to scan unread messages: %w", err)
+		}
+		states[chatID] = state
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query unread messages: %w", err)
+	}
+	return states, nil
+}
+
+// saveMentions records which other members of the chat the message mentions
+// with @username, replacing any mentions recorded before.
+func saveMentions(e execer, message *Message) error {
+	if _, err := e.Exec("DELETE FROM message_mentions WHERE message_id = ?", message.ID); err != nil {
+		return fmt.Errorf("failed to clear mentions: %w", err)
+	}
+	usernames := mentionedUsernames(message.Content)
+	if len(usernames) == 0 {
+		return nil
+	}
+	args := []interface{}{message.ID, message.ChatID, strconv.FormatInt(message.UserID, 10)}
+	for _, username := range usernames {
+		args = append(args, username)
+	}
+	_, err := e.Exec(`INSERT INTO message_mentions (message_id, user_id, chat_id)
+		SELECT ?, m.user_id, m.chat_id FROM chat_members m JOIN users u ON u.id = m.user_id
+		WHERE m.chat_id = ? AND m.user_id != ? AND u.username IN (?`+strings.Repeat(", ?", len(usernames)-1)+`)
+		ON CONFLICT DO NOTHING`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to save mentions: %w", err)
+	}
+	return nil
+}
+
+// mentionedUsernames returns the words following an @ in the content, without
+// trailing punctuation.
+func mentionedUsernames(content string) []string {
+	var usernames []string
+	for _, word := range strings.Fields(content) {
+		i := strings.IndexByte(word, '@')
+		if i < 0 || (i > 0 && (unicode.IsLetter(rune(word[i-1])) || unicode.IsDigit(rune(word[i-1])))) {
+			// Not a mention, e.g. an email address.
+			continue
+		}
+		name := strings.TrimRightFunc(word[i+1:], unicode.IsPunct)
+		if name != "" {
+			usernames = append(usernames, name)
+		}
+	}
+	return usernames
+}
@@ -4,8 +4,6 @@ import (
 	"database/sql"
 	"fmt"
 	"strconv"
-	"strings"
-	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -13,17 +11,31 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// GetUserByEmail retrieves a user by email from the database.
-func GetUserByEmail(email string) (*User, error) {
-	row := DB.QueryRow("SELECT id, username, email, password FROM users WHERE email = ?", email)
+// userColumns lists the users columns read by scanUser, in order.
+const userColumns = "id, username, email, password, email_verified_at, totp_enabled, is_admin, is_service_account"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans a row selected with userColumns.
+func scanUser(row rowScanner) (*User, error) {
 	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	var verifiedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &verifiedAt, &user.TOTPEnabled, &user.IsAdmin, &user.IsServiceAccount)
 	if err != nil {
 		return nil, err
 	}
+	user.EmailVerified = verifiedAt.Valid
 	return &user, nil
 }
 
+// GetUserByEmail retrieves a user by email from the database.
+func GetUserByEmail(email string) (*User, error) {
+	return scanUser(DB.QueryRow("SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
+
 var DB *sql.DB
 
 // InitDB initializes a new SQLite database connection and assigns it to the package-level DB variable.
@@ -40,10 +52,14 @@ func InitDB(filepath string) (*sql.DB, error) {
 }
 
 type User struct {
-	ID       string
-	Username string
-	Email    string
-	Password string
+	ID               string
+	Username         string
+	Email            string
+	Password         string
+	EmailVerified    bool
+	TOTPEnabled      bool
+	IsAdmin          bool
+	IsServiceAccount bool
 }
 
 func InsertUser(username, email, password string) (*User, error) {
@@ -79,54 +95,7 @@ func InsertUser(username, email, password string) (*User, error) {
 }
 
 func GetUserByID(id string) (*User, error) {
-	row := DB.QueryRow("SELECT id, username, email, password FROM users WHERE id = ?", id)
-	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
-type Chat struct {
-	ID      string
-	Title   string
-	UserIDs []string
-	IsGroup bool
-}
-
-func InsertChat(title string, userIDs []string, isGroup bool) (*Chat, error) {
-	userIDsStr := strings.Join(userIDs, ",")
-	res, err := DB.Exec("INSERT INTO chats (title, user_ids, is_group) VALUES (?, ?, ?)", title, userIDsStr, isGroup)
-	if err != nil {
-		return nil, err
-	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-	return &Chat{
-		ID:      strconv.FormatInt(id, 10),
-		Title:   title,
-		UserIDs: userIDs,
-		IsGroup: isGroup,
-	}, nil
-}
-
-func GetChatByID(id string) (*Chat, error) {
-	row := DB.QueryRow("SELECT id, title, user_ids, is_group FROM chats WHERE id = ?", id)
-	var chat Chat
-	var userIDsStr string
-	err := row.Scan(&chat.ID, &chat.Title, &userIDsStr, &chat.IsGroup)
-	if err != nil {
-		return nil, err
-	}
-	if userIDsStr != "" {
-		chat.UserIDs = strings.Split(userIDsStr, ",")
-	} else {
-		chat.UserIDs = []string{}
-	}
-	return &chat, nil
+	return scanUser(DB.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
 }
 
 // SetupDatabase initializes the database connection and applies migrations.
@@ -143,68 +112,7 @@ func SetupDatabase(filepath string) (*sql.DB, error) {
 	return dbConn, nil
 }
 
-func InsertUserToken(tokenID, userID, tokenValue string, expiresAt time.Time) error {
-	query := "INSERT INTO user_tokens (token_id, user_id, token_value, expires_at) VALUES (?, ?, ?, ?)"
-	_, err := DB.Exec(query, tokenID, userID, tokenValue, expiresAt)
-	return err
-}
-
-func RevokeToken(token string) error {
-	query := "DELETE FROM user_tokens WHERE token_value = ?"
-	_, err := DB.Exec(query, token)
-	return err
-}
-
 // GetUserByUsername retrieves a user by username from the database.
 func GetUserByUsername(username string) (*User, error) {
-	row := DB.QueryRow("SELECT id, username, email, password FROM users WHERE username = ?", username)
-	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
-// GetChatsByUserID retrieves all chats where the specified user is a participant.
-func GetChatsByUserID(userID string) ([]*Chat, error) {
-	// In our database, user_ids is a comma-separated list of user IDs
-	// We need to find chats where the user's ID is in this list
-	rows, err := DB.Query("SELECT id, title, user_ids, is_group FROM chats WHERE user_ids LIKE ?", "%"+userID+"%")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var chats []*Chat
-	for rows.Next() {
-		var chat Chat
-		var userIDsStr string
-		err := rows.Scan(&chat.ID, &chat.Title, &userIDsStr, &chat.IsGroup)
-		if err != nil {
-			return nil, err
-		}
-
-		// Parse the comma-separated user IDs
-		if userIDsStr != "" {
-			chat.UserIDs = strings.Split(userIDsStr, ",")
-		} else {
-			chat.UserIDs = []string{}
-		}
-
-		// Verify that the user is actually in the participants list
-		// This is needed because our LIKE query might match substrings
-		for _, id := range chat.UserIDs {
-			if id == userID {
-				chats = append(chats, &chat)
-				break
-			}
-		}
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return chats, nil
+	return scanUser(DB.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", username))
 }
@@ -0,0 +1,43 @@
+// Package dbtest sets up a migrated database for tests.
+package dbtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1akhilpandey/go-messaging/db"
+)
+
+// Setup points db.DB at a new, fully migrated SQLite database that is removed
+// when the test ends. Migrations are read relative to the module root, so the
+// working directory is changed there for the duration of the test.
+func Setup(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	root := wd
+	for {
+		if _, err := os.Stat(filepath.Join(root, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			t.Fatalf("go.mod not found above %s", wd)
+		}
+		root = parent
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatalf("failed to change to module root: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	conn, err := db.SetupDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+}
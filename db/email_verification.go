@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrVerificationTokenInvalid is returned when an email verification token is unknown, expired or already used.
+var ErrVerificationTokenInvalid = errors.New("email verification token is invalid or has expired")
+
+// InsertEmailVerificationToken stores the hash of a single-use email verification token.
+func InsertEmailVerificationToken(userID, tokenHash string, expiresAt time.Time) error {
+	query := "INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)"
+	if _, err := DB.Exec(query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert email verification token: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail consumes the verification token with the given hash and marks the user's email as verified.
+// It returns the ID of the verified user.
+func VerifyEmail(tokenHash string) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT id, user_id, expires_at, used_at FROM email_verification_tokens WHERE token_hash = ?", tokenHash)
+	var id int64
+	var userID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = row.Scan(&id, &userID, &expiresAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrVerificationTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up email verification token: %w", err)
+	}
+	if usedAt.Valid || !time.Now().Before(expiresAt) {
+		return "", ErrVerificationTokenInvalid
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE email_verification_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID); err != nil {
+		return "", fmt.Errorf("failed to consume email verification tokens: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", now, userID); err != nil {
+		return "", fmt.Errorf("failed to mark email as verified: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to verify email: %w", err)
+	}
+	return userID, nil
+}
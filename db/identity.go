@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrOIDCStateInvalid is returned when an OIDC login state is unknown, expired or already used.
+var ErrOIDCStateInvalid = errors.New("OIDC login state is invalid or has expired")
+
+// OIDCLoginState holds the values remembered between redirecting the user to
+// the identity provider and handling the callback.
+type OIDCLoginState struct {
+	Nonce        string
+	CodeVerifier string
+}
+
+// InsertOIDCLoginState stores a pending OIDC login under the hash of its state parameter.
+func InsertOIDCLoginState(stateHash string, state OIDCLoginState, expiresAt time.Time) error {
+	if err := deleteExpiredOIDCLoginStates(); err != nil {
+		return err
+	}
+	// Expiry times are stored in UTC so that they compare chronologically.
+	query := "INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at) VALUES (?, ?, ?, ?)"
+	if _, err := DB.Exec(query, stateHash, state.Nonce, state.CodeVerifier, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("failed to insert OIDC login state: %w", err)
+	}
+	return nil
+}
+
+// deleteExpiredOIDCLoginStates drops logins that were abandoned before reaching the callback.
+func deleteExpiredOIDCLoginStates() error {
+	if _, err := DB.Exec("DELETE FROM oidc_login_states WHERE expires_at <= ?", time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to delete expired OIDC login states: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginState removes the pending OIDC login with the given state hash and returns it.
+// Each state can be consumed only once.
+func ConsumeOIDCLoginState(stateHash string) (*OIDCLoginState, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT nonce, code_verifier, expires_at FROM oidc_login_states WHERE state_hash = ?", stateHash)
+	var state OIDCLoginState
+	var expiresAt time.Time
+	err = row.Scan(&state.Nonce, &state.CodeVerifier, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up OIDC login state: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM oidc_login_states WHERE state_hash = ?", stateHash); err != nil {
+		return nil, fmt.Errorf("failed to consume OIDC login state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to consume OIDC login state: %w", err)
+	}
+
+	if !time.Now().Before(expiresAt) {
+		return nil, ErrOIDCStateInvalid
+	}
+	return &state, nil
+}
+
+// GetUserByIdentity retrieves the user linked to the external identity.
+func GetUserByIdentity(issuer, subject string) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = (SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?)"
+	return scanUser(DB.QueryRow(query, issuer, subject))
+}
+
+// LinkUserIdentity links an external identity to an existing user.
+func LinkUserIdentity(userID, issuer, subject, email string) error {
+	query := "INSERT INTO user_identities (user_id, issuer, subject, email) VALUES (?, ?, ?, ?)"
+	if _, err := DB.Exec(query, userID, issuer, subject, email); err != nil {
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	return nil
+}
+
+// InsertIdentityUser creates a user for an external identity and links the two.
+// The user has no local password and their email is verified by the identity provider.
+func InsertIdentityUser(username, email, issuer, subject string) (*User, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO users (username, email, password, email_verified_at) VALUES (?, ?, '', ?)", username, email, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve last inserted ID: %w", err)
+	}
+	query := "INSERT INTO user_identities (user_id, issuer, subject, email) VALUES (?, ?, ?, ?)"
+	if _, err := tx.Exec(query, id, issuer, subject, email); err != nil {
+		return nil, fmt.Errorf("failed to link user identity: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return &User{
+		ID:            strconv.FormatInt(id, 10),
+		Username:      username,
+		Email:         email,
+		EmailVerified: true,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LoginThrottle tracks failed login attempts for one key, such as an email address or an IP address.
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// GetLoginThrottle retrieves the throttle state for the key.
+// A key without failed attempts returns an empty throttle.
+func GetLoginThrottle(key string) (*LoginThrottle, error) {
+	row := DB.QueryRow("SELECT failures, last_failure_at, locked_until FROM login_throttles WHERE throttle_key = ?", key)
+	throttle := LoginThrottle{Key: key}
+	var lockedUntil sql.NullTime
+	err := row.Scan(&throttle.Failures, &throttle.LastFailureAt, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &throttle, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up login throttle: %w", err)
+	}
+	throttle.LockedUntil = lockedUntil.Time
+	return &throttle, nil
+}
+
+// SaveLoginThrottle inserts or updates the throttle state for the throttle's key.
+func SaveLoginThrottle(throttle *LoginThrottle) error {
+	var lockedUntil sql.NullTime
+	if !throttle.LockedUntil.IsZero() {
+		lockedUntil = sql.NullTime{Time: throttle.LockedUntil, Valid: true}
+	}
+	query := `INSERT INTO login_throttles (throttle_key, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT(throttle_key) DO UPDATE SET failures = excluded.failures,
+			last_failure_at = excluded.last_failure_at, locked_until = excluded.locked_until`
+	if _, err := DB.Exec(query, throttle.Key, throttle.Failures, throttle.LastFailureAt, lockedUntil); err != nil {
+		return fmt.Errorf("failed to save login throttle: %w", err)
+	}
+	return nil
+}
+
+// ClearLoginThrottles removes the throttle state for the given keys.
+// It returns the number of keys that had failed attempts recorded.
+func ClearLoginThrottles(keys ...string) (int64, error) {
+	var cleared int64
+	for _, key := range keys {
+		res, err := DB.Exec("DELETE FROM login_throttles WHERE throttle_key = ?", key)
+		if err != nil {
+			return cleared, fmt.Errorf("failed to clear login throttle: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return cleared, fmt.Errorf("failed to clear login throttle: %w", err)
+		}
+		cleared += n
+	}
+	return cleared, nil
+}
@@ -1,32 +1,212 @@
 package db
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"strconv"
 	"time"
 )
 
+// ErrMessageNotFound is returned when a message does not exist in the chat.
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrMessageDeleted is returned when changing a message that has been deleted.
+var ErrMessageDeleted = errors.New("message has been deleted")
+
+// ErrInvalidReply is returned when a message replies to a message that cannot be replied to.
+var ErrInvalidReply = errors.New("invalid reply")
+
+// ErrDuplicateMessage is returned when a message is sent again with the same
+// client message ID. The message is filled in with the one stored before.
+var ErrDuplicateMessage = errors.New("message was already sent")
+
+// MaxClientMsgIDLength limits the length of client message IDs in bytes.
+const MaxClientMsgIDLength = 64
+
+// Message kinds.
+const (
+	// MessageKindUser is a message sent by a user.
+	MessageKindUser = "user"
+	// MessageKindSystem records a change to the chat, such as a member joining.
+	// Its UserID is the user who made the change.
+	MessageKindSystem = "system"
+)
+
 // Message represents a chat message.
 type Message struct {
 	ID        int64     `db:"id" json:"id"`
 	ChatID    int64     `db:"chat_id" json:"chat_id"`
 	UserID    int64     `db:"user_id" json:"user_id"`
+	Kind      string    `db:"kind" json:"kind"`
 	Content   string    `db:"content" json:"content"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	// Username is the sender's username. It is read with the message; the
+	// caller sets it on messages being inserted.
+	Username string `db:"-" json:"username"`
+	// EditedAt is set once the author has edited the message.
+	EditedAt sql.NullTime `db:"edited_at" json:"edited_at"`
+	// DeletedAt and DeletedBy are set once the message has been deleted for
+	// everyone. The content of a deleted message is never read back.
+	DeletedAt sql.NullTime  `db:"deleted_at" json:"deleted_at"`
+	DeletedBy sql.NullInt64 `db:"deleted_by" json:"deleted_by"`
+	// ReplyToID is the message this one replies to, and ThreadRootID the first
+	// message of the thread it belongs to.
+	ReplyToID    sql.NullInt64 `db:"reply_to_id" json:"reply_to_id"`
+	ThreadRootID sql.NullInt64 `db:"thread_root_id" json:"thread_root_id"`
+	// ClientMsgID is the sender's own ID for the message, used to store it only
+	// once when it is sent again. It is only set on messages being inserted.
+	ClientMsgID sql.NullString `db:"client_msg_id" json:"client_msg_id"`
+	// ReplyCount and LastReplyAt summarise the thread started by this message.
+	ReplyCount  int          `db:"-" json:"reply_count"`
+	LastReplyAt sql.NullTime `db:"-" json:"last_reply_at"`
+}
+
+// MessageFilter selects the messages of a chat as seen by one of its members.
+type MessageFilter struct {
+	ChatID string
+	// UserID is the member reading; messages they have hidden are left out.
+	UserID string
+	// ThreadRootID, if set, selects only the replies in that thread.
+	ThreadRootID int64
+	// FoldThreads leaves out thread replies, keeping only their root messages.
+	FoldThreads bool
+}
+
+// where returns the condition selecting the filtered messages and its arguments.
+func (f MessageFilter) where() (string, []interface{}) {
+	where := "chat_id = ? AND " + visibleTo
+	args := []interface{}{f.ChatID, f.UserID}
+	switch {
+	case f.ThreadRootID != 0:
+		where += " AND thread_root_id = ?"
+		args = append(args, f.ThreadRootID)
+	case f.FoldThreads:
+		where += " AND thread_root_id IS NULL"
+	}
+	return where, args
+}
+
+// MessageRevision is the content a message had before an edit.
+type MessageRevision struct {
+	ID        int64     `db:"id" json:"id"`
+	MessageID int64     `db:"message_id" json:"message_id"`
+	ChatID    int64     `db:"chat_id" json:"chat_id"`
+	Content   string    `db:"content" json:"content"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
 // InsertMessage saves a new message to the database.
 // It assumes message.ChatID and message.UserID are already set correctly.
+// Messages from users are refused with ErrChatArchived if the chat is archived.
+// A reply is placed in the thread of the message it replies to; ErrInvalidReply
+// is returned if that message or the thread root cannot be replied to.
+// Other members mentioned with @username are recorded. A message with the same
+// ClientMsgID as one sent before by the user to the chat is not stored again:
+// ErrDuplicateMessage is returned with the earlier message filled in.
 func InsertMessage(message *Message) error {
-	query := `INSERT INTO messages (chat_id, user_id, content, created_at, updated_at)
-			  VALUES (?, ?, ?, ?, ?)`
-	// Using Go time for timestamps for clarity, though DB defaults could also be used.
-	now := time.Now()
-	result, err := DB.Exec(query, message.ChatID, message.UserID, message.Content, now, now)
+	if err := resolveThread(message); err != nil {
+		return err
+	}
+	tx, err := DB.Begin()
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertMessage(tx, message); err != nil {
+		return err
+	}
+	if err := saveMentions(tx, message); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to insert message: %w", err)
 	}
+	return nil
+}
+
+// resolveThread checks the message's reply target and thread root, and sets
+// the thread root of a reply to the one of the message it replies to.
+func resolveThread(message *Message) error {
+	if !message.ReplyToID.Valid && !message.ThreadRootID.Valid {
+		return nil
+	}
+	targetID := message.ThreadRootID.Int64
+	if message.ReplyToID.Valid {
+		targetID = message.ReplyToID.Int64
+	}
+	var kind string
+	var deletedAt sql.NullTime
+	var rootID sql.NullInt64
+	err := DB.QueryRow("SELECT kind, deleted_at, thread_root_id FROM messages WHERE id = ? AND chat_id = ?",
+		targetID, message.ChatID).Scan(&kind, &deletedAt, &rootID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: message %d not found", ErrInvalidReply, targetID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get replied message: %w", err)
+	}
+	if kind != MessageKindUser || deletedAt.Valid {
+		return fmt.Errorf("%w: message %d cannot be replied to", ErrInvalidReply, targetID)
+	}
+
+	if !message.ReplyToID.Valid {
+		// Posting straight to a thread: the target must be a thread root.
+		if rootID.Valid {
+			return fmt.Errorf("%w: message %d is not a thread root", ErrInvalidReply, targetID)
+		}
+		return nil
+	}
+	root := targetID
+	if rootID.Valid {
+		root = rootID.Int64
+	}
+	if message.ThreadRootID.Valid && message.ThreadRootID.Int64 != root {
+		return fmt.Errorf("%w: message %d is not in thread %d", ErrInvalidReply, targetID, message.ThreadRootID.Int64)
+	}
+	message.ThreadRootID = sql.NullInt64{Int64: root, Valid: true}
+	return nil
+}
+
+func insertMessage(tx *sql.Tx, message *Message) error {
+	if message.Kind == "" {
+		message.Kind = MessageKindUser
+	}
+	// System messages may record changes to an archived chat; user messages may not.
+	// A conflict on the client message ID means the message is stored already.
+	query := `INSERT INTO messages (chat_id, user_id, kind, content, created_at, updated_at, reply_to_id, thread_root_id, client_msg_id)
+			  SELECT ?, ?, ?, ?, ?, ?, ?, ?, ? WHERE ? = ? OR NOT EXISTS (SELECT 1 FROM chats WHERE id = ? AND archived_at IS NOT NULL)
+			  ON CONFLICT DO NOTHING`
+	// Timestamps are stored in UTC so that they sort chronologically.
+	now := time.Now().UTC()
+	message.CreatedAt, message.UpdatedAt = now, now
+	result, err := tx.Exec(query, message.ChatID, message.UserID, message.Kind, message.Content, now, now,
+		message.ReplyToID, message.ThreadRootID, message.ClientMsgID, message.Kind, MessageKindSystem, message.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to insert message: %w", err)
+	}
+	if err := requireRowsAffected(result, ErrChatArchived); err != nil {
+		if !errors.Is(err, ErrChatArchived) || !message.ClientMsgID.Valid {
+			return err
+		}
+		existing, lookupErr := scanMessage(tx.QueryRow("SELECT "+messageColumns+" FROM messages WHERE chat_id = ? AND user_id = ? AND client_msg_id = ?",
+			message.ChatID, message.UserID, message.ClientMsgID))
+		if errors.Is(lookupErr, sql.ErrNoRows) {
+			return err
+		}
+		if lookupErr != nil {
+			return fmt.Errorf("failed to look up sent message: %w", lookupErr)
+		}
+		existing.ClientMsgID = message.ClientMsgID
+		*message = *existing
+		return ErrDuplicateMessage
+	}
 
 	// Retrieve and set the message.ID after insertion
 	id, err := result.LastInsertId()
@@ -43,40 +223,274 @@ func InsertMessage(message *Message) error {
 	return nil
 }
 
-// GetMessagesByChatID retrieves all messages for a specific chat ID.
-// Messages are ordered by creation time (oldest first).
-func GetMessagesByChatID(chatID string) ([]*Message, error) {
-	// Convert string chat ID to int64
-	chatIDInt, err := strconv.ParseInt(chatID, 10, 64)
+// messageColumns lists the messages columns read by scanMessage, in order.
+// The sender's username is read along with them. Deleted messages are read as
+// tombstones without their content, and deleted replies are left out of a
+// thread's reply count.
+const messageColumns = `id, chat_id, user_id, (SELECT username FROM users WHERE users.id = messages.user_id), kind,
+	CASE WHEN deleted_at IS NULL THEN content ELSE '' END, created_at, updated_at, edited_at, deleted_at, deleted_by, reply_to_id, thread_root_id,
+	(SELECT COUNT(*) FROM messages r WHERE r.thread_root_id = messages.id AND r.deleted_at IS NULL),
+	(SELECT r.created_at FROM messages r WHERE r.thread_root_id = messages.id AND r.deleted_at IS NULL ORDER BY r.id DESC LIMIT 1)`
+
+// visibleTo restricts a query on messages to those not hidden by the user whose ID is the next argument.
+const visibleTo = "NOT EXISTS (SELECT 1 FROM message_hidden h WHERE h.message_id = messages.id AND h.user_id = ?)"
+
+func scanMessage(row rowScanner) (*Message, error) {
+	var msg Message
+	if err := row.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.Username, &msg.Kind, &msg.Content, &msg.CreatedAt, &msg.UpdatedAt,
+		&msg.EditedAt, &msg.DeletedAt, &msg.DeletedBy, &msg.ReplyToID, &msg.ThreadRootID, &msg.ReplyCount, &msg.LastReplyAt); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetMessage returns the message with the given ID in the chat as seen by the
+// user, or ErrMessageNotFound if it does not exist or the user has hidden it.
+func GetMessage(chatID, userID, messageID string) (*Message, error) {
+	query := "SELECT " + messageColumns + " FROM messages WHERE id = ? AND chat_id = ? AND " + visibleTo
+	msg, err := scanMessage(DB.QueryRow(query, messageID, chatID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("invalid chat ID format: %w", err)
+		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
+	return msg, nil
+}
 
-	// Query to get all messages for the chat, ordered by creation time
-	query := `SELECT id, chat_id, user_id, content, created_at, updated_at
-			  FROM messages
-			  WHERE chat_id = ?
-			  ORDER BY created_at ASC`
+// EditMessage replaces the message's content, keeping the previous content as
+// a revision, updates its mentions and updates msg to match. It returns ErrMessageDeleted if the
+// message has been deleted.
+func EditMessage(msg *Message, content string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	rows, err := DB.Query(query, chatIDInt)
+	// The previous content was written when the message was last updated.
+	res, err := tx.Exec(`INSERT INTO message_revisions (message_id, chat_id, content, created_at)
+		SELECT id, chat_id, content, updated_at FROM messages WHERE id = ? AND deleted_at IS NULL`, msg.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query messages: %w", err)
+		return fmt.Errorf("failed to save message revision: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrMessageDeleted); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE messages SET content = ?, updated_at = ?, edited_at = ? WHERE id = ?", content, now, now, msg.ID); err != nil {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
+	edited := *msg
+	edited.Content = content
+	if err := saveMentions(tx, &edited); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
+	msg.Content = content
+	msg.UpdatedAt = now
+	msg.EditedAt = sql.NullTime{Time: now, Valid: true}
+	return nil
+}
+
+// DeleteMessage deletes the message for everyone, leaving a tombstone, removes
+// its reactions and updates msg to match. If purge is set its content and revisions are erased
+// at once; otherwise they are left for PurgeDeletedMessages. It returns
+// ErrMessageDeleted if the message was already deleted.
+func DeleteMessage(msg *Message, deletedBy int64, purge bool) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec("UPDATE messages SET deleted_at = ?, deleted_by = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		now, deletedBy, now, msg.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	if err := requireRowsAffected(res, ErrMessageDeleted); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM message_reactions WHERE message_id = ?", msg.ID); err != nil {
+		return fmt.Errorf("failed to delete message reactions: %w", err)
+	}
+	if purge {
+		if err := purgeMessageContent(tx, "id = ?", msg.ID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	msg.Content = ""
+	msg.UpdatedAt = now
+	msg.DeletedAt = sql.NullTime{Time: now, Valid: true}
+	msg.DeletedBy = sql.NullInt64{Int64: deletedBy, Valid: true}
+	return nil
+}
+
+// PurgeDeletedMessages erases the content and revisions of messages deleted
+// before the given time, and returns how many messages were purged.
+func PurgeDeletedMessages(before time.Time) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Deletion times are stored in UTC, so they sort chronologically as text.
+	var n int64
+	where := "deleted_at IS NOT NULL AND deleted_at <= ?"
+	if err := tx.QueryRow("SELECT COUNT(*) FROM messages WHERE "+where+" AND content != ''", before.UTC()).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count deleted messages: %w", err)
+	}
+	if err := purgeMessageContent(tx, where, before.UTC()); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to purge deleted messages: %w", err)
+	}
+	return n, nil
+}
+
+// purgeMessageContent erases the content and revisions of the messages matching the condition.
+func purgeMessageContent(tx *sql.Tx, where string, args ...interface{}) error {
+	if _, err := tx.Exec("DELETE FROM message_revisions WHERE message_id IN (SELECT id FROM messages WHERE "+where+")", args...); err != nil {
+		return fmt.Errorf("failed to purge message revisions: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE messages SET content = '' WHERE "+where, args...); err != nil {
+		return fmt.Errorf("failed to purge message content: %w", err)
+	}
+	return nil
+}
+
+// HideMessage hides a message of the chat from the user only.
+func HideMessage(chatID, userID string, messageID int64) error {
+	_, err := DB.Exec("INSERT INTO message_hidden (message_id, user_id, chat_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		messageID, userID, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to hide message: %w", err)
+	}
+	return nil
+}
+
+// UnhideMessage shows a message the user had hidden again. It returns
+// ErrMessageNotFound if the user had not hidden it.
+func UnhideMessage(chatID, userID, messageID string) error {
+	res, err := DB.Exec("DELETE FROM message_hidden WHERE message_id = ? AND user_id = ? AND chat_id = ?", messageID, userID, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to unhide message: %w", err)
+	}
+	return requireRowsAffected(res, ErrMessageNotFound)
+}
+
+// GetMessageRevisions returns the earlier revisions of a message, oldest
+// first. Deleted messages have no revisions.
+func GetMessageRevisions(messageID int64) ([]*MessageRevision, error) {
+	rows, err := DB.Query(`SELECT r.id, r.message_id, r.chat_id, r.content, r.created_at FROM message_revisions r
+		JOIN messages m ON m.id = r.message_id WHERE r.message_id = ? AND m.deleted_at IS NULL ORDER BY r.id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message revisions: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*Message
+	var revisions []*MessageRevision
 	for rows.Next() {
-		var msg Message
-		err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.Content, &msg.CreatedAt, &msg.UpdatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message row: %w", err)
+		var rev MessageRevision
+		if err := rows.Scan(&rev.ID, &rev.MessageID, &rev.ChatID, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message revision row: %w", err)
 		}
-		messages = append(messages, &msg)
+		revisions = append(revisions, &rev)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message revision rows: %w", err)
+	}
+	return revisions, nil
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating message rows: %w", err)
+// GetMessagesBefore returns up to limit of the filtered messages with an ID
+// below beforeID, oldest first, and whether older messages remain.
+func GetMessagesBefore(f MessageFilter, beforeID int64, limit int) ([]*Message, bool, error) {
+	where, args := f.where()
+	query := "SELECT " + messageColumns + " FROM messages WHERE " + where + " AND id < ? ORDER BY id DESC LIMIT ?"
+	messages, more, err := queryMessagePage(limit, query, append(args, beforeID, limit+1)...)
+	if err != nil {
+		return nil, false, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
 	}
+	return messages, more, nil
+}
+
+// GetMessagesAfter returns up to limit of the filtered messages with an ID
+// above afterID, oldest first, and whether newer messages remain.
+func GetMessagesAfter(f MessageFilter, afterID int64, limit int) ([]*Message, bool, error) {
+	where, args := f.where()
+	query := "SELECT " + messageColumns + " FROM messages WHERE " + where + " AND id > ? ORDER BY id LIMIT ?"
+	return queryMessagePage(limit, query, append(args, afterID, limit+1)...)
+}
+
+// HasMessagesBefore reports whether any of the filtered messages has an ID below beforeID.
+func HasMessagesBefore(f MessageFilter, beforeID int64) (bool, error) {
+	where, args := f.where()
+	var exists bool
+	if err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM messages WHERE "+where+" AND id < ?)", append(args, beforeID)...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query messages: %w", err)
+	}
+	return exists, nil
+}
 
-	return messages, nil
+// HasMessagesAfter reports whether any of the filtered messages has an ID above afterID.
+func HasMessagesAfter(f MessageFilter, afterID int64) (bool, error) {
+	where, args := f.where()
+	var exists bool
+	if err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM messages WHERE "+where+" AND id > ?)", append(args, afterID)...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query messages: %w", err)
+	}
+	return exists, nil
+}
+
+// GetMessageIDAt returns the ID of the first of the filtered messages sent at
+// or after t. It returns sql.ErrNoRows if there is none.
+func GetMessageIDAt(f MessageFilter, t time.Time) (int64, error) {
+	// Timestamps are stored in UTC, so they sort chronologically as text.
+	where, args := f.where()
+	var id int64
+	query := "SELECT id FROM messages WHERE " + where + " AND created_at >= ? ORDER BY created_at, id LIMIT 1"
+	err := DB.QueryRow(query, append(args, t.UTC())...).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// queryMessagePage runs a query selecting messageColumns with one row more than
+// limit, and reports whether that extra row was found.
+func queryMessagePage(limit int, query string, args ...interface{}) ([]*Message, bool, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan message row: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("error iterating message rows: %w", err)
+	}
+	if len(messages) > limit {
+		return messages[:limit], true, nil
+	}
+	return messages, false, nil
 }
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrReactionNotFound is returned when removing a reaction the user has not made.
+var ErrReactionNotFound = errors.New("reaction not found")
+
+// ReactionSummary counts the reactions to a message with one emoji.
+type ReactionSummary struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	// Reacted reports whether the reading user is among them.
+	Reacted bool `json:"reacted"`
+}
+
+// AddReaction records the user's reaction to a message of the chat. It
+// reports false if the user had already reacted with that emoji.
+func AddReaction(chatID, messageID int64, userID, emoji string) (bool, error) {
+	res, err := DB.Exec(`INSERT INTO message_reactions (message_id, user_id, emoji, chat_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`, messageID, userID, emoji, chatID)
+	if err != nil {
+		return false, fmt.Errorf("failed to add reaction: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RemoveReaction removes the user's reaction to a message. It returns
+// ErrReactionNotFound if the user had not reacted with that emoji.
+func RemoveReaction(messageID int64, userID, emoji string) error {
+	res, err := DB.Exec("DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji)
+	if err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return requireRowsAffected(res, ErrReactionNotFound)
+}
+
+// CountReactions returns how many users reacted to a message with the emoji.
+func CountReactions(messageID int64, emoji string) (int, error) {
+	var n int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM message_reactions WHERE message_id = ? AND emoji = ?", messageID, emoji).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	return n, nil
+}
+
+// GetReactions returns the reactions to each of the messages, as seen by the
+// user, keyed by message ID. Emoji are listed in the order they were first used.
+func GetReactions(messageIDs []int64, userID string) (map[int64][]ReactionSummary, error) {
+	reactions := make(map[int64][]ReactionSummary)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+	args := []interface{}{userID}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+	query := `SELECT message_id, emoji, COUNT(*), MAX(user_id = ?) FROM message_reactions
+		WHERE message_id IN (?` + strings.Repeat(", ?", len(messageIDs)-1) + `)
+		GROUP BY message_id, emoji ORDER BY message_id, MIN(rowid)`
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var summary ReactionSummary
+		if err := rows.Scan(&messageID, &summary.Emoji, &summary.Count, &summary.Reacted); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction row: %w", err)
+		}
+		reactions[messageID] = append(reactions[messageID], summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reaction rows: %w", err)
+	}
+	return reactions, nil
+}
@@ -0,0 +1,8 @@
+-- Migration: Remove refresh token tracking
+DROP INDEX IF EXISTS idx_user_tokens_family_id;
+DROP INDEX IF EXISTS idx_user_tokens_user_id;
+DROP INDEX IF EXISTS idx_user_tokens_token_value;
+DELETE FROM user_tokens WHERE token_type = 'refresh';
+ALTER TABLE user_tokens DROP COLUMN used_at;
+ALTER TABLE user_tokens DROP COLUMN family_id;
+ALTER TABLE user_tokens DROP COLUMN token_type;
@@ -0,0 +1,11 @@
+-- Migration: Track token type, token family and refresh token usage
+ALTER TABLE user_tokens ADD COLUMN token_type TEXT NOT NULL DEFAULT 'access';
+ALTER TABLE user_tokens ADD COLUMN family_id TEXT;
+ALTER TABLE user_tokens ADD COLUMN used_at DATETIME;
+
+-- Tokens issued before this migration each form their own family
+UPDATE user_tokens SET family_id = token_id WHERE family_id IS NULL;
+
+CREATE INDEX idx_user_tokens_token_value ON user_tokens(token_value);
+CREATE INDEX idx_user_tokens_user_id ON user_tokens(user_id);
+CREATE INDEX idx_user_tokens_family_id ON user_tokens(family_id);
@@ -0,0 +1,5 @@
+-- Migration: Remove session device details
+ALTER TABLE user_tokens DROP COLUMN last_used_at;
+ALTER TABLE user_tokens DROP COLUMN ip_address;
+ALTER TABLE user_tokens DROP COLUMN user_agent;
+ALTER TABLE user_tokens DROP COLUMN device_name;
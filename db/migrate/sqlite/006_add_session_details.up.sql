@@ -0,0 +1,5 @@
+-- Migration: Record the device each session was started from
+ALTER TABLE user_tokens ADD COLUMN device_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_tokens ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_tokens ADD COLUMN last_used_at DATETIME;
@@ -0,0 +1,2 @@
+-- Migration: Drop password reset tokens table
+DROP TABLE IF EXISTS password_reset_tokens;
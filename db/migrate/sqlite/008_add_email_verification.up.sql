@@ -0,0 +1,17 @@
+-- Migration: Track email verification
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+
+-- Accounts created before verification was introduced are treated as verified
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
+
+CREATE TABLE email_verification_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_email_verification_tokens_user_id ON email_verification_tokens(user_id);
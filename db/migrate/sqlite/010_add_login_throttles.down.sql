@@ -0,0 +1,3 @@
+-- Migration: Remove login throttling and administrators
+ALTER TABLE users DROP COLUMN is_admin;
+DROP TABLE IF EXISTS login_throttles;
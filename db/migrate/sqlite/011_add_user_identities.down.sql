@@ -0,0 +1,3 @@
+-- Migration: Remove external identities
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,3 @@
+-- Migration: Drop API keys and service accounts
+DROP TABLE IF EXISTS api_keys;
+ALTER TABLE users DROP COLUMN is_service_account;
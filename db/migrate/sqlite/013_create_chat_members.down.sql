@@ -0,0 +1,10 @@
+-- Migration: Move chat participants back into chats.user_ids
+ALTER TABLE chats ADD COLUMN user_ids TEXT;
+
+UPDATE chats SET user_ids = (
+    SELECT group_concat(user_id, ',') FROM (
+        SELECT user_id FROM chat_members WHERE chat_id = chats.id ORDER BY rowid
+    )
+);
+
+DROP TABLE IF EXISTS chat_members;
@@ -0,0 +1,31 @@
+-- Migration: Move chat participants from chats.user_ids into chat_members
+CREATE TABLE chat_members (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, user_id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_chat_members_user_id ON chat_members(user_id, chat_id);
+
+-- Split the comma-separated user_ids of every chat, skipping blanks, duplicates and unknown users
+INSERT OR IGNORE INTO chat_members (chat_id, user_id, role)
+WITH RECURSIVE split(chat_id, pos, item, rest) AS (
+    SELECT id, 0, '', user_ids || ',' FROM chats WHERE user_ids IS NOT NULL AND user_ids != ''
+    UNION ALL
+    SELECT chat_id, pos + 1, trim(substr(rest, 1, instr(rest, ',') - 1)), substr(rest, instr(rest, ',') + 1)
+    FROM split WHERE rest != ''
+)
+SELECT chat_id, CAST(item AS INTEGER), 'member' FROM split
+WHERE pos > 0 AND item != '' AND item NOT GLOB '*[^0-9]*'
+  AND CAST(item AS INTEGER) IN (SELECT id FROM users)
+ORDER BY chat_id, pos;
+
+-- The creator was not recorded, so the first listed participant becomes the owner
+UPDATE chat_members SET role = 'owner'
+WHERE rowid IN (SELECT MIN(rowid) FROM chat_members GROUP BY chat_id);
+
+ALTER TABLE chats DROP COLUMN user_ids;
@@ -0,0 +1,3 @@
+-- Migration: Remove message kinds
+DELETE FROM messages WHERE kind = 'system';
+ALTER TABLE messages DROP COLUMN kind;
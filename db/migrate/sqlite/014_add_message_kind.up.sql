@@ -0,0 +1,2 @@
+-- Migration: Distinguish system messages from messages sent by users
+ALTER TABLE messages ADD COLUMN kind TEXT NOT NULL DEFAULT 'user';
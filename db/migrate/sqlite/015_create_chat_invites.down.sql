@@ -0,0 +1,3 @@
+-- Migration: Drop chat invite links
+DROP TABLE IF EXISTS chat_invite_uses;
+DROP TABLE IF EXISTS chat_invites;
@@ -0,0 +1,37 @@
+-- Migration: Create chat invite links and their audit log
+-- Only the hash of each invite code is stored, like API keys.
+CREATE TABLE chat_invites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    code_prefix TEXT NOT NULL,
+    code_hash TEXT NOT NULL UNIQUE,
+    created_by INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    max_uses INTEGER,
+    uses INTEGER NOT NULL DEFAULT 0,
+    requires_approval BOOLEAN NOT NULL DEFAULT 0,
+    revoked_at DATETIME,
+    FOREIGN KEY(chat_id) REFERENCES chats(id),
+    FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_chat_invites_chat_id ON chat_invites(chat_id);
+
+-- Every use of an invite: direct joins and join requests awaiting or after approval
+CREATE TABLE chat_invite_uses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    invite_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    decided_by INTEGER,
+    decided_at DATETIME,
+    FOREIGN KEY(invite_id) REFERENCES chat_invites(id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id),
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_chat_invite_uses_invite_id ON chat_invite_uses(invite_id);
+CREATE INDEX idx_chat_invite_uses_chat_id ON chat_invite_uses(chat_id, status);
@@ -0,0 +1,3 @@
+-- Migration: Remove one-to-one chat keys
+DROP INDEX IF EXISTS idx_chats_dm_key;
+ALTER TABLE chats DROP COLUMN dm_key;
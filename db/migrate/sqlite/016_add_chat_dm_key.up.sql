@@ -0,0 +1,14 @@
+-- Migration: Identify one-to-one chats by the pair of users in them
+ALTER TABLE chats ADD COLUMN dm_key TEXT;
+
+-- Existing one-to-one chats keep their key; when a pair has several, the oldest one wins
+WITH pairs AS (
+    SELECT m.chat_id, MIN(m.user_id) || ':' || MAX(m.user_id) AS dm_key
+    FROM chat_members m JOIN chats c ON c.id = m.chat_id
+    WHERE c.is_group = 0
+    GROUP BY m.chat_id HAVING COUNT(*) = 2
+)
+UPDATE chats SET dm_key = (SELECT dm_key FROM pairs WHERE pairs.chat_id = chats.id)
+WHERE id IN (SELECT MIN(chat_id) FROM pairs GROUP BY dm_key);
+
+CREATE UNIQUE INDEX idx_chats_dm_key ON chats(dm_key);
@@ -0,0 +1,4 @@
+-- Migration: Remove chat descriptions, avatars and archiving
+ALTER TABLE chats DROP COLUMN archived_at;
+ALTER TABLE chats DROP COLUMN avatar_url;
+ALTER TABLE chats DROP COLUMN description;
@@ -0,0 +1,4 @@
+-- Migration: Add chat descriptions, avatars and archiving
+ALTER TABLE chats ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE chats ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE chats ADD COLUMN archived_at DATETIME;
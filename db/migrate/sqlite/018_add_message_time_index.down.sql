@@ -0,0 +1,2 @@
+-- Migration: Remove the message time index
+DROP INDEX IF EXISTS idx_messages_chat_created_at;
@@ -0,0 +1,2 @@
+-- Migration: Index messages by time within a chat for jumping to a date
+CREATE INDEX idx_messages_chat_created_at ON messages(chat_id, created_at);
@@ -0,0 +1,3 @@
+-- Migration: Remove message revisions
+DROP TABLE message_revisions;
+ALTER TABLE messages DROP COLUMN edited_at;
@@ -0,0 +1,15 @@
+-- Migration: Track message edits and keep every earlier revision
+ALTER TABLE messages ADD COLUMN edited_at DATETIME;
+
+-- Each row holds the content a message had before an edit, and when that content was written
+CREATE TABLE message_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY(message_id) REFERENCES messages(id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id)
+);
+
+CREATE INDEX idx_message_revisions_message_id ON message_revisions(message_id);
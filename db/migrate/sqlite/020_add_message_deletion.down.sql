@@ -0,0 +1,5 @@
+-- Migration: Remove message deletion
+DROP TABLE message_hidden;
+DROP INDEX idx_messages_deleted_at;
+ALTER TABLE messages DROP COLUMN deleted_by;
+ALTER TABLE messages DROP COLUMN deleted_at;
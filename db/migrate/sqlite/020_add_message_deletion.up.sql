@@ -0,0 +1,19 @@
+-- Migration: Soft-delete messages and let users hide messages for themselves
+-- A deleted message stays in history as a tombstone; its content is purged later.
+ALTER TABLE messages ADD COLUMN deleted_at DATETIME;
+ALTER TABLE messages ADD COLUMN deleted_by INTEGER;
+
+CREATE INDEX idx_messages_deleted_at ON messages(deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE message_hidden (
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY(message_id) REFERENCES messages(id),
+    FOREIGN KEY(user_id) REFERENCES users(id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id)
+);
+
+CREATE INDEX idx_message_hidden_chat_user ON message_hidden(chat_id, user_id);
@@ -0,0 +1,4 @@
+-- Migration: Remove replies and threads from messages
+DROP INDEX idx_messages_thread_root_id;
+ALTER TABLE messages DROP COLUMN thread_root_id;
+ALTER TABLE messages DROP COLUMN reply_to_id;
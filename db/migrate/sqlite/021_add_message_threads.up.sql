@@ -0,0 +1,6 @@
+-- Migration: Add replies and threads to messages
+-- reply_to_id is the message quoted by a reply; thread_root_id is the first message of its thread.
+ALTER TABLE messages ADD COLUMN reply_to_id INTEGER;
+ALTER TABLE messages ADD COLUMN thread_root_id INTEGER;
+
+CREATE INDEX idx_messages_thread_root_id ON messages(thread_root_id, id) WHERE thread_root_id IS NOT NULL;
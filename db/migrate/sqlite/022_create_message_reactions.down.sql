@@ -0,0 +1,2 @@
+-- Migration: Remove message reactions
+DROP TABLE message_reactions;
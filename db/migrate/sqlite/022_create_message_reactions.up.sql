@@ -0,0 +1,14 @@
+-- Migration: Create emoji reactions on messages, one row per user and emoji
+CREATE TABLE message_reactions (
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    emoji TEXT NOT NULL,
+    chat_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, emoji),
+    FOREIGN KEY(message_id) REFERENCES messages(id),
+    FOREIGN KEY(user_id) REFERENCES users(id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id)
+);
+
+CREATE INDEX idx_message_reactions_chat_id ON message_reactions(chat_id);
@@ -0,0 +1,3 @@
+-- Migration: Remove read receipts and mentions
+DROP TABLE message_mentions;
+ALTER TABLE chat_members DROP COLUMN last_read_message_id;
@@ -0,0 +1,17 @@
+-- Migration: Track what each member has read and whom each message mentions
+ALTER TABLE chat_members ADD COLUMN last_read_message_id INTEGER NOT NULL DEFAULT 0;
+
+-- Existing members start with everything read.
+UPDATE chat_members SET last_read_message_id = COALESCE((SELECT MAX(id) FROM messages WHERE messages.chat_id = chat_members.chat_id), 0);
+
+CREATE TABLE message_mentions (
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY(message_id) REFERENCES messages(id),
+    FOREIGN KEY(user_id) REFERENCES users(id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id)
+);
+
+CREATE INDEX idx_message_mentions_user_chat ON message_mentions(user_id, chat_id, message_id);
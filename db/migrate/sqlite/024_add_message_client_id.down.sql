@@ -0,0 +1,3 @@
+-- Migration: Remove client message IDs
+DROP INDEX idx_messages_client_msg_id;
+ALTER TABLE messages DROP COLUMN client_msg_id;
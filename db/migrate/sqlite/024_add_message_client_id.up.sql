@@ -0,0 +1,4 @@
+-- Migration: Let clients tag messages with their own ID so that retries are not stored twice
+ALTER TABLE messages ADD COLUMN client_msg_id TEXT;
+
+CREATE UNIQUE INDEX idx_messages_client_msg_id ON messages(chat_id, user_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Migration: Remove used two-factor login challenges
+DROP TABLE IF EXISTS used_mfa_challenges;
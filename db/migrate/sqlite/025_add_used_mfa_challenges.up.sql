@@ -0,0 +1,7 @@
+-- Migration: Remember used two-factor login challenges so that each can be used only once
+CREATE TABLE used_mfa_challenges (
+    jti TEXT PRIMARY KEY,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_used_mfa_challenges_expires_at ON used_mfa_challenges(expires_at);
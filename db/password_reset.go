@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrResetTokenInvalid is returned when a password reset token is unknown, expired or already used.
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or has expired")
+
+// InsertPasswordResetToken stores the hash of a single-use password reset token.
+func InsertPasswordResetToken(userID, tokenHash string, expiresAt time.Time) error {
+	query := "INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)"
+	if _, err := DB.Exec(query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert password reset token: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword consumes the reset token with the given hash and sets the user's new password.
+// Outstanding reset tokens and every session of the user are revoked in the same transaction.
+// It returns the ID of the user whose password was changed.
+func ResetPassword(tokenHash, newPassword string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT id, user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = ?", tokenHash)
+	var id int64
+	var userID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = row.Scan(&id, &userID, &expiresAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrResetTokenInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up password reset token: %w", err)
+	}
+	if usedAt.Valid || !time.Now().Before(expiresAt) {
+		return "", ErrResetTokenInvalid
+	}
+
+	res, err := tx.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now(), id)
+	if err != nil {
+		return "", fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return "", ErrResetTokenInvalid
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", string(hashedPassword), userID); err != nil {
+		return "", fmt.Errorf("failed to update password: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM password_reset_tokens WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return "", fmt.Errorf("failed to revoke password reset tokens: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM user_tokens WHERE user_id = ?", userID); err != nil {
+		return "", fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to reset password: %w", err)
+	}
+	evictCachedTokens(func(t UserToken) bool { return t.UserID == userID })
+	return userID, nil
+}
@@ -0,0 +1,330 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Token types stored in the user_tokens table.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// ErrTokenInactive is returned when a token has been revoked or has expired.
+var ErrTokenInactive = errors.New("token has been revoked or has expired")
+
+// ErrRefreshTokenReused is returned when an already-used refresh token is presented again.
+// The token's whole family is revoked before this error is returned.
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to another user.
+var ErrSessionNotFound = errors.New("session not found")
+
+// tokenCacheTTL bounds how long a token stays trusted without re-checking the
+// database. Revocations made by this process invalidate the cache immediately.
+const tokenCacheTTL = 30 * time.Second
+
+// tokenCacheMaxEntries caps the cache size; the cache is reset when it is full.
+const tokenCacheMaxEntries = 10000
+
+// UserToken represents a row in the user_tokens table.
+// Tokens issued from the same login share a FamilyID, which identifies the session.
+type UserToken struct {
+	TokenID    string
+	UserID     string
+	FamilyID   string
+	Type       string
+	ExpiresAt  time.Time
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+}
+
+// Session describes an active login, represented by its current refresh token.
+type Session struct {
+	TokenID    string
+	FamilyID   string
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+type tokenCacheEntry struct {
+	token    UserToken
+	cachedAt time.Time
+}
+
+// tokenCache holds recently validated access tokens keyed by token value.
+var tokenCache = struct {
+	sync.Mutex
+	entries map[string]tokenCacheEntry
+}{entries: make(map[string]tokenCacheEntry)}
+
+// evictCachedTokens removes every cached token matching the predicate.
+func evictCachedTokens(match func(UserToken) bool) {
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+	for value, entry := range tokenCache.entries {
+		if match(entry.token) {
+			delete(tokenCache.entries, value)
+		}
+	}
+}
+
+// InsertUserToken stores a token. For refresh tokens, tokenValue must be the token hash.
+func InsertUserToken(token UserToken, tokenValue string) error {
+	query := `INSERT INTO user_tokens (token_id, user_id, token_value, expires_at, token_type, family_id,
+			  device_name, user_agent, ip_address, last_used_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := DB.Exec(query, token.TokenID, token.UserID, tokenValue, token.ExpiresAt, token.Type, token.FamilyID,
+		token.DeviceName, token.UserAgent, token.IPAddress, time.Now())
+	return err
+}
+
+func RevokeToken(token string) error {
+	query := "DELETE FROM user_tokens WHERE token_value = ?"
+	if _, err := DB.Exec(query, token); err != nil {
+		return err
+	}
+	tokenCache.Lock()
+	delete(tokenCache.entries, token)
+	tokenCache.Unlock()
+	return nil
+}
+
+// RevokeTokenFamily revokes every access and refresh token issued from the same login.
+func RevokeTokenFamily(familyID string) error {
+	if _, err := DB.Exec("DELETE FROM user_tokens WHERE family_id = ?", familyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+	evictCachedTokens(func(t UserToken) bool { return t.FamilyID == familyID })
+	return nil
+}
+
+// RevokeUserTokens revokes every outstanding token issued to the given user.
+func RevokeUserTokens(userID string) error {
+	if _, err := DB.Exec("DELETE FROM user_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	evictCachedTokens(func(t UserToken) bool { return t.UserID == userID })
+	return nil
+}
+
+// RevokeOtherUserTokens revokes every token issued to the user except those in keepFamilyID.
+// It returns the IDs of the revoked families.
+func RevokeOtherUserTokens(userID, keepFamilyID string) ([]string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT DISTINCT family_id FROM user_tokens WHERE user_id = ? AND family_id != ?", userID, keepFamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	var families []string
+	for rows.Next() {
+		var familyID string
+		if err := rows.Scan(&familyID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan session row: %w", err)
+		}
+		families = append(families, familyID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session rows: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_tokens WHERE user_id = ? AND family_id != ?", userID, keepFamilyID); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	evictCachedTokens(func(t UserToken) bool { return t.UserID == userID && t.FamilyID != keepFamilyID })
+	return families, nil
+}
+
+// GetActiveUserToken returns the stored access token matching tokenValue.
+// It returns ErrTokenInactive if the token was revoked or has expired.
+// Recently validated tokens are served from an in-process cache; on a cache
+// miss the session's last-used time is updated.
+func GetActiveUserToken(tokenValue string) (*UserToken, error) {
+	now := time.Now()
+
+	tokenCache.Lock()
+	entry, ok := tokenCache.entries[tokenValue]
+	tokenCache.Unlock()
+	if ok && now.Sub(entry.cachedAt) < tokenCacheTTL && now.Before(entry.token.ExpiresAt) {
+		token := entry.token
+		return &token, nil
+	}
+
+	row := DB.QueryRow(`SELECT token_id, user_id, family_id, token_type, expires_at, device_name, user_agent, ip_address
+						FROM user_tokens
+						WHERE token_value = ? AND token_type = ?`, tokenValue, TokenTypeAccess)
+	var token UserToken
+	err := row.Scan(&token.TokenID, &token.UserID, &token.FamilyID, &token.Type, &token.ExpiresAt,
+		&token.DeviceName, &token.UserAgent, &token.IPAddress)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenInactive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up token: %w", err)
+	}
+	if !now.Before(token.ExpiresAt) {
+		return nil, ErrTokenInactive
+	}
+
+	// Record activity on the session's current refresh token.
+	_, err = DB.Exec(`UPDATE user_tokens SET last_used_at = ?
+					  WHERE family_id = ? AND token_type = ? AND used_at IS NULL`, now, token.FamilyID, TokenTypeRefresh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session activity: %w", err)
+	}
+
+	tokenCache.Lock()
+	if len(tokenCache.entries) >= tokenCacheMaxEntries {
+		tokenCache.entries = make(map[string]tokenCacheEntry)
+	}
+	tokenCache.entries[tokenValue] = tokenCacheEntry{token: token, cachedAt: now}
+	tokenCache.Unlock()
+
+	return &token, nil
+}
+
+// GetUserTokenByID retrieves a token of the given user by its token ID.
+// It returns ErrSessionNotFound if no such token belongs to the user.
+func GetUserTokenByID(userID, tokenID string) (*UserToken, error) {
+	row := DB.QueryRow(`SELECT token_id, user_id, family_id, token_type, expires_at, device_name, user_agent, ip_address
+						FROM user_tokens
+						WHERE token_id = ? AND user_id = ?`, tokenID, userID)
+	var token UserToken
+	err := row.Scan(&token.TokenID, &token.UserID, &token.FamilyID, &token.Type, &token.ExpiresAt,
+		&token.DeviceName, &token.UserAgent, &token.IPAddress)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up token: %w", err)
+	}
+	return &token, nil
+}
+
+// GetUserSessions returns the user's active sessions, most recently used first.
+func GetUserSessions(userID string) ([]*Session, error) {
+	// Used refresh tokens are kept until they expire, so the earliest row of a
+	// family records when the session started.
+	query := `SELECT token_id, family_id, device_name, user_agent, ip_address, created_at, last_used_at, expires_at, used_at
+			  FROM user_tokens
+			  WHERE user_id = ? AND token_type = ?`
+	rows, err := DB.Query(query, userID, TokenTypeRefresh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	startedAt := make(map[string]time.Time)
+	var sessions []*Session
+	for rows.Next() {
+		var session Session
+		var lastUsedAt, usedAt sql.NullTime
+		err := rows.Scan(&session.TokenID, &session.FamilyID, &session.DeviceName, &session.UserAgent,
+			&session.IPAddress, &session.CreatedAt, &lastUsedAt, &session.ExpiresAt, &usedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session row: %w", err)
+		}
+		if started, ok := startedAt[session.FamilyID]; !ok || session.CreatedAt.Before(started) {
+			startedAt[session.FamilyID] = session.CreatedAt
+		}
+		if usedAt.Valid || !now.Before(session.ExpiresAt) {
+			continue
+		}
+		session.LastUsedAt = session.CreatedAt
+		if lastUsedAt.Valid {
+			session.LastUsedAt = lastUsedAt.Time
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session rows: %w", err)
+	}
+
+	for _, session := range sessions {
+		session.CreatedAt = startedAt[session.FamilyID]
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// ConsumeRefreshToken marks the refresh token with the given hash as used and returns it.
+// Presenting a token that was already used revokes its whole family and returns the
+// token together with ErrRefreshTokenReused; unknown or expired tokens return ErrTokenInactive.
+func ConsumeRefreshToken(tokenHash string) (*UserToken, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`SELECT token_id, user_id, family_id, token_type, expires_at, device_name, user_agent, ip_address, used_at
+						FROM user_tokens
+						WHERE token_value = ? AND token_type = ?`, tokenHash, TokenTypeRefresh)
+	var token UserToken
+	var usedAt sql.NullTime
+	err = row.Scan(&token.TokenID, &token.UserID, &token.FamilyID, &token.Type, &token.ExpiresAt,
+		&token.DeviceName, &token.UserAgent, &token.IPAddress, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenInactive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+
+	reused := usedAt.Valid
+	if !reused {
+		if !time.Now().Before(token.ExpiresAt) {
+			return nil, ErrTokenInactive
+		}
+		res, err := tx.Exec("UPDATE user_tokens SET used_at = ? WHERE token_id = ? AND used_at IS NULL", time.Now(), token.TokenID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark refresh token as used: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark refresh token as used: %w", err)
+		}
+		// Another request consumed the token concurrently.
+		reused = n == 0
+	}
+
+	if reused {
+		if _, err := tx.Exec("DELETE FROM user_tokens WHERE family_id = ?", token.FamilyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke token family: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to revoke token family: %w", err)
+		}
+		evictCachedTokens(func(t UserToken) bool { return t.FamilyID == token.FamilyID })
+		return &token, ErrRefreshTokenReused
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+	return &token, nil
+}
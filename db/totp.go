@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTOTPAlreadyEnabled is returned when enrolling a user who already has two-factor authentication.
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// TOTPState holds a user's TOTP secret and replay-protection state.
+type TOTPState struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// GetTOTPState retrieves the TOTP secret and state for the user.
+func GetTOTPState(userID string) (*TOTPState, error) {
+	row := DB.QueryRow("SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?", userID)
+	var state TOTPState
+	var secret sql.NullString
+	if err := row.Scan(&secret, &state.Enabled, &state.LastStep); err != nil {
+		return nil, err
+	}
+	state.Secret = secret.String
+	return &state, nil
+}
+
+// SetPendingTOTPSecret stores a new secret for a user who has not enabled two-factor authentication yet.
+func SetPendingTOTPSecret(userID, secret string) error {
+	res, err := DB.Exec("UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND totp_enabled = 0", secret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+	if n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication and replaces the user's recovery codes.
+// step is the time step of the code used for confirmation, which may not be used again.
+func EnableTOTP(userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE id = ? AND totp_enabled = 0", step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication and deletes the user's secret and recovery codes.
+func DisableTOTP(userID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	return nil
+}
+
+// RecordTOTPStep records that the code for step was used. It returns false if
+// that step, or a later one, was already used, so each code works only once.
+func RecordTOTPStep(userID string, step int64) (bool, error) {
+	res, err := DB.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode marks the user's unused recovery code with the given hash as used.
+// It returns false if no such unused code exists.
+func UseRecoveryCode(userID, codeHash string) (bool, error) {
+	res, err := DB.Exec("UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now(), userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return n > 0, nil
+}
+
+// MFAChallengeUsed reports whether the two-factor login challenge with the given ID was used.
+func MFAChallengeUsed(challengeID string) (bool, error) {
+	var used bool
+	if err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM used_mfa_challenges WHERE jti = ?)", challengeID).Scan(&used); err != nil {
+		return false, fmt.Errorf("failed to look up MFA challenge: %w", err)
+	}
+	return used, nil
+}
+
+// UseMFAChallenge records that the two-factor login challenge with the given
+// ID was used. It returns false if it was used before, so each challenge works
+// only once. Challenges are forgotten once they have expired.
+func UseMFAChallenge(challengeID string, expiresAt time.Time) (bool, error) {
+	// Expiry times are stored in UTC so that they compare chronologically.
+	if _, err := DB.Exec("DELETE FROM used_mfa_challenges WHERE expires_at <= ?", time.Now().UTC()); err != nil {
+		return false, fmt.Errorf("failed to delete expired MFA challenges: %w", err)
+	}
+	res, err := DB.Exec("INSERT INTO used_mfa_challenges (jti, expires_at) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		challengeID, expiresAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to record MFA challenge: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record MFA challenge: %w", err)
+	}
+	return n == 1, nil
+}
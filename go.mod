@@ -6,7 +6,6 @@ toolchain go1.24.2
 
 require (
 	github.com/go-chi/chi/v5 v5.2.1
-	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/golang-jwt/jwt/v4 v4.5.2
 	github.com/golang-migrate/migrate/v4 v4.18.2
 	github.com/google/uuid v1.6.0
@@ -3,18 +3,55 @@ package main
 import (
 	"log"
 	"net/http"
+	"strings"
 
-	"github.com/1akhilpandey/go-messaging/app/api/handler"
-	authMiddleware "github.com/1akhilpandey/go-messaging/app/middleware"
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/app/mail"
+	"github.com/1akhilpandey/go-messaging/app/oidc"
 	"github.com/1akhilpandey/go-messaging/app/ws"
+	"github.com/1akhilpandey/go-messaging/config"
 	"github.com/1akhilpandey/go-messaging/db"
-	"github.com/go-chi/chi/v5"
-	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
 func main() {
+	// Load configuration from the environment.
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Configuration failed: %v", err)
+	}
+
+	// Load the JWT signing keys.
+	if _, err := auth.InitKeys(cfg.JWTKeysFile, cfg.JWTSecret); err != nil {
+		log.Fatalf("JWT key setup failed: %v", err)
+	}
+
+	// Configure outgoing email.
+	switch cfg.MailDriver {
+	case "smtp":
+		controller.SetMailer(&mail.SMTPMailer{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	default:
+		controller.SetMailer(&mail.OutboxMailer{Dir: cfg.MailOutboxDir})
+	}
+
+	// Configure single sign-on.
+	if cfg.OIDCEnabled() {
+		controller.SetOIDCProvider(oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+		}))
+	}
+
 	// Set up the database and apply migrations.
-	database, err := db.SetupDatabase("chatapp.db")
+	database, err := db.SetupDatabase(cfg.DatabasePath)
 	if err != nil {
 		log.Fatalf("Database setup failed: %v", err)
 	}
@@ -23,44 +60,16 @@ func main() {
 	// Create a new WebSocket hub and run it.
 	hub := ws.NewHub()
 	go hub.Run()
+	controller.SetNotifier(hub)
 
-	// Set up router.
-	r := chi.NewRouter()
-	r.Use(chiMiddleware.Logger)
-	r.Use(chiMiddleware.Recoverer)
-
-	// User routes.
-	r.Route("/user", func(r chi.Router) {
-		// Public endpoints.
-		r.Post("/signup", handler.CreateUserHandler)
-		r.Post("/login", handler.LoginUserHandler)
-
-		// Protected endpoint.
-		r.Group(func(r chi.Router) {
-			r.Use(authMiddleware.AuthMiddleware)
-			r.Post("/logout", handler.LogoutUserHandler)
-		})
-	})
-
-	// Protected routes.
-	r.Group(func(r chi.Router) {
-		r.Use(authMiddleware.AuthMiddleware)
+	// Purge the content of deleted messages once it is no longer retained.
+	go controller.RunDeletedMessagePurge()
 
-		// Chat routes.
-		r.Route("/chat", func(r chi.Router) {
-			r.Get("/messages/{id}", handler.GetChatHandler)
-			r.Post("/message", handler.CreateChatHandler)
-			r.Get("/user", handler.GetUserChatsHandler)
-		})
-
-		// WebSocket endpoint.
-		r.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-			ws.ServeWs(hub, w, r)
-		})
-	})
+	// Set up router.
+	r := newRouter(cfg, hub)
 
-	log.Println("Server starting on :8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
+	log.Printf("Server starting on %s", cfg.Addr)
+	if err := http.ListenAndServe(cfg.Addr, r); err != nil {
 		log.Fatalf("ListenAndServe: %v", err)
 	}
 }
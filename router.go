@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/1akhilpandey/go-messaging/app/api/handler"
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	authMiddleware "github.com/1akhilpandey/go-messaging/app/middleware"
+	"github.com/1akhilpandey/go-messaging/app/ws"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// newRouter sets up the HTTP routes. WebSocket connections join the given hub.
+func newRouter(cfg *config.Config, hub *ws.Hub) http.Handler {
+	r := chi.NewRouter()
+	r.Use(chiMiddleware.Logger)
+	r.Use(chiMiddleware.Recoverer)
+
+	// Public keys for verifying issued tokens.
+	r.Get("/.well-known/jwks.json", handler.JWKSHandler)
+
+	// User routes.
+	r.Route("/user", func(r chi.Router) {
+		// Public endpoints.
+		r.Post("/signup", handler.CreateUserHandler)
+		r.Post("/login", handler.LoginUserHandler)
+		r.Post("/login/2fa", handler.TwoFactorLoginHandler)
+		r.Post("/token/refresh", handler.RefreshTokenHandler)
+		r.Post("/password/forgot", handler.ForgotPasswordHandler)
+		r.Post("/password/reset", handler.ResetPasswordHandler)
+		r.Get("/verify", handler.VerifyEmailHandler)
+		r.Post("/verify/resend", handler.ResendVerificationHandler)
+		if cfg.OIDCEnabled() {
+			r.Get("/oidc/login", handler.OIDCLoginHandler)
+			r.Get("/oidc/callback", handler.OIDCCallbackHandler)
+		}
+
+		// Protected endpoints.
+		// Account management is not available to API keys.
+		r.Group(func(r chi.Router) {
+			r.Use(authMiddleware.AuthMiddleware)
+			r.Use(authMiddleware.RequireSession)
+			r.Post("/logout", handler.LogoutUserHandler)
+			r.Post("/logout/all", handler.LogoutAllUserHandler)
+
+			// Session management.
+			r.Get("/sessions", handler.GetUserSessionsHandler)
+			r.Delete("/sessions/{tokenID}", handler.RevokeSessionHandler)
+			r.Post("/sessions/revoke-others", handler.RevokeOtherSessionsHandler)
+
+			// Two-factor authentication.
+			r.Post("/2fa/enroll", handler.EnrollTOTPHandler)
+			r.Post("/2fa/confirm", handler.ConfirmTOTPHandler)
+			r.Post("/2fa/disable", handler.DisableTOTPHandler)
+
+			// API keys.
+			r.Get("/api-keys", handler.GetAPIKeysHandler)
+			r.Post("/api-keys", handler.CreateAPIKeyHandler)
+			r.Post("/api-keys/{keyID}/rotate", handler.RotateAPIKeyHandler)
+			r.Delete("/api-keys/{keyID}", handler.RevokeAPIKeyHandler)
+		})
+	})
+
+	// Protected routes.
+	r.Group(func(r chi.Router) {
+		r.Use(authMiddleware.AuthMiddleware)
+
+		// Chat routes.
+		r.Route("/chat", func(r chi.Router) {
+			r.With(
+				authMiddleware.RequireScope(auth.ScopeChatRead),
+				authMiddleware.RequireChatMember(authMiddleware.ChatIDFromURLParam("id")),
+			).Get("/messages/{id}", handler.GetChatHandler)
+			r.With(authMiddleware.RequireScope(auth.ScopeChatWrite)).Post("/message", handler.CreateChatHandler)
+			r.With(authMiddleware.RequireScope(auth.ScopeChatWrite)).Post("/direct/{userID}", handler.DirectChatHandler)
+			r.With(authMiddleware.RequireScope(auth.ScopeChatRead)).Get("/user", handler.GetUserChatsHandler)
+			r.With(authMiddleware.RequireScope(auth.ScopeChatRead)).Post("/read-all", handler.MarkAllChatsReadHandler)
+
+			// Invite codes are used by people who are not members yet.
+			r.With(authMiddleware.RequireScope(auth.ScopeChatRead)).Get("/invites/{code}", handler.PreviewChatInviteHandler)
+			r.With(authMiddleware.RequireScope(auth.ScopeChatWrite)).Post("/invites/{code}/accept", handler.AcceptChatInviteHandler)
+
+			// Routes scoped to a single chat require membership.
+			r.Route("/{id}", func(r chi.Router) {
+				r.Use(authMiddleware.RequireChatMember(authMiddleware.ChatIDFromURLParam("id")))
+				r.Group(func(r chi.Router) {
+					r.Use(authMiddleware.RequireScope(auth.ScopeChatRead))
+					r.Get("/messages", handler.GetChatHandler)
+					r.Get("/messages/{messageID}/thread", handler.GetThreadHandler)
+					r.Get("/messages/{messageID}/revisions", handler.GetMessageHistoryHandler)
+					r.Get("/members", handler.GetChatMembersHandler)
+					r.Get("/invites", handler.GetChatInvitesHandler)
+					r.Get("/invites/{inviteID}/uses", handler.GetChatInviteUsesHandler)
+					r.Get("/join-requests", handler.GetJoinRequestsHandler)
+					// Marking messages read only needs read access.
+					r.Post("/read", handler.MarkChatReadHandler)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(authMiddleware.RequireScope(auth.ScopeChatWrite))
+					r.Post("/members", handler.AddChatMembersHandler)
+					r.Delete("/members/{userID}", handler.RemoveChatMemberHandler)
+					r.Put("/members/{userID}/role", handler.SetChatMemberRoleHandler)
+					r.Post("/leave", handler.LeaveChatHandler)
+					r.Post("/transfer", handler.TransferChatOwnershipHandler)
+					r.Patch("/", handler.UpdateChatHandler)
+					r.Post("/archive", handler.ArchiveChatHandler)
+					r.Post("/unarchive", handler.UnarchiveChatHandler)
+					r.Delete("/", handler.DeleteChatHandler)
+					r.Post("/invites", handler.CreateChatInviteHandler)
+					r.Delete("/invites/{inviteID}", handler.RevokeChatInviteHandler)
+					r.Post("/join-requests/{requestID}/approve", handler.ApproveJoinRequestHandler)
+					r.Post("/join-requests/{requestID}/reject", handler.RejectJoinRequestHandler)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(authMiddleware.RequireScope(auth.ScopeMessageWrite))
+					r.Post("/messages", handler.SendMessageHandler)
+					r.Patch("/messages/{messageID}", handler.EditMessageHandler)
+					r.Delete("/messages/{messageID}", handler.DeleteMessageHandler)
+					r.Post("/messages/{messageID}/hide", handler.HideMessageHandler)
+					r.Delete("/messages/{messageID}/hide", handler.UnhideMessageHandler)
+					r.Put("/messages/{messageID}/reactions/{emoji}", handler.AddReactionHandler)
+					r.Delete("/messages/{messageID}/reactions/{emoji}", handler.RemoveReactionHandler)
+				})
+			})
+		})
+
+		// WebSocket endpoint. Only chat members may join; sending messages
+		// additionally requires the message:write scope.
+		r.With(
+			authMiddleware.RequireScope(auth.ScopeChatRead),
+			authMiddleware.RequireChatMember(authMiddleware.ChatIDFromQuery("chat_id")),
+		).HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+			ws.ServeWs(hub, w, r)
+		})
+	})
+
+	// Admin routes.
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(authMiddleware.AuthMiddleware)
+		r.Use(authMiddleware.RequireScope(auth.ScopeAdmin))
+		r.Use(authMiddleware.RequireAdmin)
+		r.Post("/users/unlock", handler.UnlockLoginHandler)
+
+		// Service accounts.
+		r.Get("/service-accounts", handler.GetServiceAccountsHandler)
+		r.Post("/service-accounts", handler.CreateServiceAccountHandler)
+		r.Get("/service-accounts/{accountID}/api-keys", handler.GetServiceAccountAPIKeysHandler)
+		r.Post("/service-accounts/{accountID}/api-keys", handler.CreateServiceAccountAPIKeyHandler)
+		r.Post("/service-accounts/{accountID}/api-keys/{keyID}/rotate", handler.RotateServiceAccountAPIKeyHandler)
+		r.Delete("/service-accounts/{accountID}/api-keys/{keyID}", handler.RevokeServiceAccountAPIKeyHandler)
+	})
+
+	return r
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1akhilpandey/go-messaging/app/api/controller"
+	"github.com/1akhilpandey/go-messaging/app/auth"
+	"github.com/1akhilpandey/go-messaging/app/ws"
+	"github.com/1akhilpandey/go-messaging/config"
+	"github.com/1akhilpandey/go-messaging/db"
+	"github.com/1akhilpandey/go-messaging/db/dbtest"
+	"github.com/gorilla/websocket"
+)
+
+// chatAccessFixture is a server with a chat owned by a member, and a user who is not a member.
+type chatAccessFixture struct {
+	server    *httptest.Server
+	chatID    string
+	member    string
+	nonMember string
+}
+
+func setupChatAccess(t *testing.T) chatAccessFixture {
+	t.Helper()
+	dbtest.Setup(t)
+	if _, err := auth.InitKeys("", "test-secret"); err != nil {
+		t.Fatalf("failed to set up keys: %v", err)
+	}
+	hub := ws.NewHub()
+	go hub.Run()
+	controller.SetNotifier(hub)
+
+	server := httptest.NewServer(newRouter(config.C, hub))
+	t.Cleanup(server.Close)
+
+	member := createUser(t, "member")
+	chat, err := db.InsertChat("room", member.ID, nil, true)
+	if err != nil {
+		t.Fatalf("failed to create chat: %v", err)
+	}
+	createUser(t, "outsider")
+
+	return chatAccessFixture{
+		server:    server,
+		chatID:    chat.ID,
+		member:    accessToken(t, "member"),
+		nonMember: accessToken(t, "outsider"),
+	}
+}
+
+func createUser(t *testing.T, username string) *db.User {
+	t.Helper()
+	user, err := db.InsertUser(username, username+"@example.com", "password")
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+	return user
+}
+
+func accessToken(t *testing.T, username string) string {
+	t.Helper()
+	resp, err := controller.LoginUser(username+"@example.com", "password", controller.ClientInfo{DeviceName: "test"})
+	if err != nil || resp.TokenResponse == nil {
+		t.Fatalf("failed to log in %s: %v", username, err)
+	}
+	return resp.AccessToken
+}
+
+func TestChatRoutesRequireMembership(t *testing.T) {
+	f := setupChatAccess(t)
+
+	paths := []string{
+		"/chat/messages/%s",
+		"/chat/%s/messages",
+		"/chat/%s/members",
+	}
+	tests := []struct {
+		name   string
+		chatID string
+		token  string
+		want   int
+	}{
+		{name: "member", chatID: f.chatID, token: f.member, want: http.StatusOK},
+		{name: "non-member", chatID: f.chatID, token: f.nonMember, want: http.StatusForbidden},
+		{name: "missing chat", chatID: "9999", token: f.member, want: http.StatusNotFound},
+		{name: "non-numeric chat ID", chatID: "abc", token: f.member, want: http.StatusBadRequest},
+		{name: "unauthenticated", chatID: f.chatID, want: http.StatusUnauthorized},
+	}
+	for _, path := range paths {
+		for _, tt := range tests {
+			url := fmt.Sprintf(path, tt.chatID)
+			t.Run(tt.name+" "+url, func(t *testing.T) {
+				req, err := http.NewRequest(http.MethodGet, f.server.URL+url, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.want {
+					t.Errorf("GET %s = %d, want %d", url, resp.StatusCode, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestWebSocketRequiresMembership(t *testing.T) {
+	f := setupChatAccess(t)
+	wsURL := "ws" + strings.TrimPrefix(f.server.URL, "http") + "/ws"
+
+	tests := []struct {
+		name  string
+		query string
+		token string
+		want  int
+	}{
+		{name: "member", query: "?chat_id=" + f.chatID, token: f.member, want: http.StatusSwitchingProtocols},
+		{name: "non-member", query: "?chat_id=" + f.chatID, token: f.nonMember, want: http.StatusForbidden},
+		{name: "missing chat", query: "?chat_id=9999", token: f.member, want: http.StatusNotFound},
+		{name: "non-numeric chat ID", query: "?chat_id=abc", token: f.member, want: http.StatusBadRequest},
+		{name: "no chat ID", token: f.member, want: http.StatusBadRequest},
+		{name: "unauthenticated", query: "?chat_id=" + f.chatID, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.token != "" {
+				header.Set("Authorization", "Bearer "+tt.token)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL+tt.query, header)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("dial failed without a response: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("upgrade = %d, want %d (%v)", resp.StatusCode, tt.want, err)
+			}
+		})
+	}
+}
+
+// apiKey creates an API key for the user with the given scopes.
+func apiKey(t *testing.T, username string, scopes ...string) string {
+	t.Helper()
+	key, err := controller.CreateAPIKey(username, controller.CreateAPIKeyInput{Name: "test", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("failed to create API key for %s: %v", username, err)
+	}
+	return key.Key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	f := setupChatAccess(t)
+	// Unverified users may not send messages; verify the member so only the scopes decide.
+	member, err := db.GetUserByUsername("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertEmailVerificationToken(member.ID, "verify-member", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.VerifyEmail("verify-member"); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := apiKey(t, "member", auth.ScopeChatRead, auth.ScopeChatWrite)
+	messaging := apiKey(t, "member", auth.ScopeChatRead, auth.ScopeMessageWrite)
+	messages := "/chat/" + f.chatID + "/messages"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "send without message:write", method: http.MethodPost, path: messages, token: readOnly, want: http.StatusForbidden},
+		{name: "send with message:write", method: http.MethodPost, path: messages, token: messaging, want: http.StatusCreated},
+		{name: "send with session", method: http.MethodPost, path: messages, token: f.member, want: http.StatusCreated},
+		{name: "read without message:write", method: http.MethodGet, path: messages, token: readOnly, want: http.StatusOK},
+		{name: "list sessions with key", method: http.MethodGet, path: "/user/sessions", token: messaging, want: http.StatusForbidden},
+		{name: "list sessions with session", method: http.MethodGet, path: "/user/sessions", token: f.member, want: http.StatusOK},
+		{name: "create API key with key", method: http.MethodPost, path: "/user/api-keys", token: readOnly, want: http.StatusForbidden},
+		{name: "enroll 2FA with key", method: http.MethodPost, path: "/user/2fa/enroll", token: messaging, want: http.StatusForbidden},
+		{name: "log out everywhere with key", method: http.MethodPost, path: "/user/logout/all", token: messaging, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, f.server.URL+tt.path, strings.NewReader(`{"content":"hello"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}